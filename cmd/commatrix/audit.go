@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/nftables"
+)
+
+func runAudit(args []string) error {
+	fs, f := newFlagSet("audit", commatrix.Formats())
+	role := fs.String("role", "", "node role of the audited node")
+	counters := fs.String("counters", "", "path to the output of 'nft list ruleset' of a node running an audit mode ruleset")
+	logFile := fs.String("log", "", "path to the kernel log of a node running an audit mode ruleset, e.g. the output of 'journalctl -k'")
+	logPrefix := fs.String("log-prefix", "commatrix-audit: ", "prefix of the audit log lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.validateFormat(); err != nil {
+		return err
+	}
+	if *counters == "" && *logFile == "" {
+		return fmt.Errorf("at least one of --counters and --log is required")
+	}
+
+	m := commatrix.ComMatrix{Matrix: make([]commatrix.ComDetails, 0)}
+	if *counters != "" {
+		data, err := os.ReadFile(*counters)
+		if err != nil {
+			return fmt.Errorf("failed to read counters file: %w", err)
+		}
+
+		counted, err := nftables.ParseAuditCounters(data, *role)
+		if err != nil {
+			return err
+		}
+		m.Matrix = append(m.Matrix, counted.Matrix...)
+	}
+
+	if *logFile != "" {
+		file, err := os.Open(*logFile)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		defer file.Close()
+
+		logged, err := nftables.ParseAuditLog(file, *role, *logPrefix)
+		if err != nil {
+			return err
+		}
+		m.Matrix = append(m.Matrix, logged.Matrix...)
+	}
+	m.Matrix = commatrix.RemoveDups(m.Matrix)
+
+	out, err := formatMatrix(m, f.format)
+	if err != nil {
+		return err
+	}
+
+	return f.write(out)
+}
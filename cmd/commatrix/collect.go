@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/collector"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+func runCollect(args []string) error {
+	fs, f := newFlagSet("collect", commatrix.Formats())
+	opts := collector.Options{}
+	fs.StringVar(&opts.Namespace, "namespace", "default", "namespace of the debug pods or the DaemonSet")
+	fs.StringVar(&opts.Image, "image", "", "image of the debug pods")
+	fs.StringVar(&opts.DaemonSet, "daemonset", "", "name of an existing DaemonSet to use instead of debug pods")
+	fs.IntVar(&opts.Concurrency, "concurrency", 5, "maximal number of nodes collected in parallel")
+	fs.DurationVar(&opts.NodeTimeout, "node-timeout", 2*time.Minute, "timeout of the collection of a single node")
+	perNode := fs.Bool("per-node", false, "keep an entry per node instead of merging the entries of each node role")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.validateFormat(); err != nil {
+		return err
+	}
+
+	cs, err := client.New(f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	exec, err := collector.NewRemoteExecutor(cs)
+	if err != nil {
+		return err
+	}
+
+	c, err := collector.New(cs, exec, opts)
+	if err != nil {
+		return err
+	}
+
+	// Partial results are still written, and the failing nodes are reported.
+	results, err := c.Collect(context.Background())
+	var nodesErr *collector.NodesError
+	if err != nil && !errors.As(err, &nodesErr) {
+		return err
+	}
+
+	cds := make([]commatrix.ComDetails, 0)
+	for _, res := range results {
+		for _, cd := range res.ComDetails {
+			if !*perNode {
+				cd.NodeName = ""
+			}
+			cds = append(cds, cd)
+		}
+	}
+	if !*perNode {
+		cds = commatrix.RemoveDups(cds)
+	}
+
+	out, err := formatMatrix(commatrix.ComMatrix{Matrix: cds}, f.format)
+	if err != nil {
+		return err
+	}
+
+	err = f.write(out)
+	if err != nil {
+		return err
+	}
+
+	if nodesErr != nil {
+		fmt.Fprintln(os.Stderr, nodesErr)
+		return fmt.Errorf("failed to collect %d nodes", len(nodesErr.Failed))
+	}
+
+	return nil
+}
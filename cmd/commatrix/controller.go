@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/liornoy/node-comm-lib/pkg/api/v1alpha1"
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/controller"
+)
+
+func runController(args []string) error {
+	fs, f := newFlagSet("controller", nil)
+	opts := controller.Options{}
+	fs.StringVar(&opts.Name, "name", "commatrix", "name of the written CommunicationMatrix or ConfigMap")
+	fs.StringVar(&opts.Namespace, "namespace", "commatrix", "namespace of the written ConfigMap")
+	fs.StringVar(&opts.Output, "kind", controller.OutputCommunicationMatrix, "kind of the written object: CommunicationMatrix or ConfigMap")
+	overlayFile := fs.String("overlay", "", "path to an overlay file applied to the generated matrix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *overlayFile != "" {
+		o, err := commatrix.LoadOverlayFile(*overlayFile)
+		if err != nil {
+			return err
+		}
+		opts.Overlays = append(opts.Overlays, o)
+	}
+
+	cs, err := client.New(f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return fmt.Errorf("failed to create scheme: %w", err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return fmt.Errorf("failed to create scheme: %w", err)
+	}
+
+	mgr, err := ctrl.NewManager(cs.Config, ctrl.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create manager: %w", err)
+	}
+
+	// Read the watched objects from the manager cache.
+	cs.Client = mgr.GetClient()
+	r := &controller.Reconciler{ClientSet: cs, Recorder: mgr.GetEventRecorderFor("commatrix"), Options: opts}
+	if err := r.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up controller: %w", err)
+	}
+
+	return mgr.Start(ctrl.SetupSignalHandler())
+}
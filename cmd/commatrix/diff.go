@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/nftables"
+)
+
+func runDiff(args []string) error {
+	fs, f := newFlagSet("diff", reportFormats)
+	role := fs.String("role", "", "node role of the rulesets given as .nft files, the documented matrix is reduced to this role")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: commatrix diff [flags] <documented-matrix> [<listening-matrix>]")
+		fmt.Fprintln(fs.Output(), "When the second matrix file is omitted, the matrix is generated from the cluster.")
+		fmt.Fprintln(fs.Output(), "A .nft second file is parsed as the output of 'nft list ruleset' or 'nft -j list ruleset'.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.validateFormat(); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return fmt.Errorf("expected one or two matrix files, got %d", fs.NArg())
+	}
+
+	documented, err := commatrix.LoadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var other commatrix.ComMatrix
+	switch {
+	case fs.NArg() == 1:
+		other, err = clusterMatrix(f.kubeconfig)
+	case filepath.Ext(fs.Arg(1)) == ".nft":
+		other, err = rulesetMatrix(fs.Arg(1), *role)
+		documented = roleMatrix(documented, *role)
+	default:
+		other, err = commatrix.LoadFile(fs.Arg(1))
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := formatReport(commatrix.Reconcile(documented, other), f.format)
+	if err != nil {
+		return err
+	}
+
+	return f.write(out)
+}
+
+// rulesetMatrix returns the ports accepted by the nftables ruleset file.
+func rulesetMatrix(path string, role string) (commatrix.ComMatrix, error) {
+	if role == "" {
+		return commatrix.ComMatrix{}, fmt.Errorf("--role is required to compare a ruleset")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return commatrix.ComMatrix{}, fmt.Errorf("failed to read ruleset file: %w", err)
+	}
+
+	return nftables.ParseRuleset(data, role)
+}
+
+func roleMatrix(m commatrix.ComMatrix, role string) commatrix.ComMatrix {
+	res := commatrix.ComMatrix{Matrix: make([]commatrix.ComDetails, 0)}
+	for _, cd := range m.Matrix {
+		if cd.NodeRole == role {
+			res.Matrix = append(res.Matrix, cd)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/firewalld"
+)
+
+func runFirewalld(args []string) error {
+	fs, f := newFlagSet("firewalld", nil)
+	input := fs.String("input", "", "path to a matrix file, defaults to generating the matrix from the cluster")
+	dir := fs.String("dir", "", "write the services and zones to the services and zones subdirectories of this directory")
+	zoneServices := fs.String("zone-services", "ssh", "comma separated existing firewalld services added to every zone")
+	opts := firewalld.Options{}
+	fs.StringVar(&opts.Prefix, "prefix", "commatrix-", "prefix of the service and zone names")
+	fs.StringVar(&opts.Target, "target", "DROP", "zone target: DROP, default, ACCEPT or %%REJECT%%")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return fmt.Errorf("--dir is required")
+	}
+
+	opts.ZoneServices = make([]string, 0)
+	if *zoneServices != "" {
+		opts.ZoneServices = strings.Split(*zoneServices, ",")
+	}
+
+	m, err := inputMatrix(*input, f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	return firewalld.WriteToDir(m.Matrix, opts, *dir)
+}
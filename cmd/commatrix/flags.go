@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// commonFlags are the flags shared by all the commands.
+type commonFlags struct {
+	kubeconfig string
+	format     string
+	formats    []string
+	output     string
+}
+
+// newFlagSet returns a flag set with the common flags, and with a --format flag when formats are given.
+func newFlagSet(name string, formats []string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	f := &commonFlags{formats: formats}
+
+	fs.StringVar(&f.kubeconfig, "kubeconfig", "", "path to the kubeconfig file, defaults to $KUBECONFIG or the in-cluster config")
+	fs.StringVar(&f.output, "output", "", "path to the output file, defaults to stdout")
+	if len(formats) > 0 {
+		fs.StringVar(&f.format, "format", "csv", "output format: "+strings.Join(formats, ", "))
+	}
+
+	return fs, f
+}
+
+func (f *commonFlags) validateFormat() error {
+	for _, format := range f.formats {
+		if f.format == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported format %q", f.format)
+}
+
+// write writes the data to the output file, or to stdout when no output file is set.
+func (f *commonFlags) write(data []byte) error {
+	if f.output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	err := os.WriteFile(f.output, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return nil
+}
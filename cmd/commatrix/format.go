@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// reportFormats are the formats of the reconciliation report.
+var reportFormats = []string{"csv", "json", "yaml", "table"}
+
+func formatMatrix(m commatrix.ComMatrix, format string) ([]byte, error) {
+	f, err := commatrix.GetFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Format(m)
+}
+
+func formatReport(r commatrix.ReconcileReport, format string) ([]byte, error) {
+	switch format {
+	case "csv":
+		return r.ToCSV()
+	case "json":
+		return r.ToJSON()
+	case "yaml":
+		out, err := r.ToJSON()
+		if err != nil {
+			return nil, err
+		}
+		return yaml.JSONToYAML(out)
+	case "table":
+		return r.ToTable()
+	}
+
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// formatObjects returns the objects as a multi-document YAML stream.
+func formatObjects(objects []interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	for _, obj := range objects {
+		doc, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert object to YAML: %w", err)
+		}
+		out.WriteString("---\n")
+		out.Write(doc)
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/endpointslices"
+)
+
+func runGenerate(args []string) error {
+	fs, f := newFlagSet("generate", commatrix.Formats())
+	overlayFile := fs.String("overlay", "", "path to an overlay file adding, removing and overriding matrix entries")
+	noGenerationTime := fs.Bool("no-generation-time", false, "omit the generation time from the metadata, for reproducible output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.validateFormat(); err != nil {
+		return err
+	}
+
+	overlays := make([]commatrix.Overlay, 0)
+	if *overlayFile != "" {
+		o, err := commatrix.LoadOverlayFile(*overlayFile)
+		if err != nil {
+			return err
+		}
+		overlays = append(overlays, o)
+	}
+
+	m, err := clusterMatrix(f.kubeconfig, overlays...)
+	if err != nil {
+		return err
+	}
+	if *noGenerationTime {
+		m = m.WithoutGenerationTime()
+	}
+
+	out, err := formatMatrix(m, f.format)
+	if err != nil {
+		return err
+	}
+
+	return f.write(out)
+}
+
+// clusterMatrix creates the ComMatrix from the ingress EndpointSlices of the cluster, and applies the overlays.
+func clusterMatrix(kubeconfig string, overlays ...commatrix.Overlay) (commatrix.ComMatrix, error) {
+	cs, err := client.New(kubeconfig)
+	if err != nil {
+		return commatrix.ComMatrix{}, err
+	}
+
+	epSliceQuery, err := endpointslices.NewQuery(cs)
+	if err != nil {
+		return commatrix.ComMatrix{}, fmt.Errorf("failed creating EndpointSlices query: %w", err)
+	}
+
+	ingressSlice := epSliceQuery.
+		WithHostNetwork().
+		WithLabels(map[string]string{consts.IngressLabel: ""}).
+		WithServiceType(corev1.ServiceTypeNodePort).
+		WithServiceType(corev1.ServiceTypeLoadBalancer).
+		Query()
+
+	m, err := commatrix.CreateComMatrix(cs, ingressSlice, overlays...)
+	if err != nil {
+		return commatrix.ComMatrix{}, err
+	}
+	m.Metadata.Query = epSliceQuery.Params()
+
+	return m, nil
+}
+
+// inputMatrix loads the ComMatrix from the input file, or creates it from the cluster when no input file is set.
+func inputMatrix(input string, kubeconfig string) (commatrix.ComMatrix, error) {
+	if input != "" {
+		return commatrix.LoadFile(input)
+	}
+
+	return clusterMatrix(kubeconfig)
+}
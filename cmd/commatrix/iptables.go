@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/iptables"
+)
+
+func runIptables(args []string) error {
+	fs, f := newFlagSet("iptables", nil)
+	input := fs.String("input", "", "path to a matrix file, defaults to generating the matrix from the cluster")
+	dir := fs.String("dir", "", "write the rules per node role, and per node for node specific entries, to this directory")
+	policyFile := fs.String("policy", "", "path to a source policy file restricting the sources of the matrix ports")
+	defaultPolicy := fs.Bool("default-policy", false, "restrict the etcd ports to master nodes and the kubelet port to the cluster network")
+	clusterNetworks := fs.String("cluster-network", "", "comma separated cluster network CIDRs used by the source policy, overriding the cluster network config")
+	opts := iptables.Options{}
+	fs.StringVar(&opts.Family, "family", "ipv4", "address family: ipv4 (iptables-restore) or ipv6 (ip6tables-restore)")
+	fs.StringVar(&opts.Chain, "chain", "COMMATRIX-INPUT", "dedicated chain name")
+	fs.BoolVar(&opts.JumpFromInput, "jump", false, "insert a rule jumping from the INPUT chain to the dedicated chain, for the first load only")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	m, err := inputMatrix(*input, f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	if *policyFile != "" || *defaultPolicy {
+		opts.Sources, err = resolvePolicy(f.kubeconfig, *policyFile, *clusterNetworks)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *dir != "" {
+		return writeIptablesRulesToDir(m, opts, *dir)
+	}
+
+	rules, err := iptables.GetRules(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	return f.write([]byte(rules))
+}
+
+func writeIptablesRulesToDir(m commatrix.ComMatrix, opts iptables.Options, dir string) error {
+	rules, err := iptables.GetRulesByRole(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	nodeRules, err := iptables.GetRulesByNode(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	for node, nodeRule := range nodeRules {
+		if _, ok := rules[node]; ok {
+			return fmt.Errorf("node %s has the same name as a node role", node)
+		}
+		rules[node] = nodeRule
+	}
+
+	return iptables.WriteRulesToDir(rules, opts.Family, dir)
+}
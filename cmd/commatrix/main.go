@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: commatrix <command> [flags]
+
+Commands:
+  generate    Query the cluster and build the communication matrix
+  diff        Compare two matrix files, or a matrix file with the cluster
+  merge       Merge matrix files, reporting their conflicts
+  nft         Render nftables rules from a matrix file or the cluster
+  iptables    Render iptables-restore rules from a matrix file or the cluster
+  firewalld   Render firewalld services and zones from a matrix file or the cluster
+  netpol      Render NetworkPolicies for the pod network Services of the matrix
+  audit       List the undocumented ports found by an audit mode ruleset
+  collect     Gather the listening sockets of the cluster nodes
+  controller  Regenerate the matrix in the cluster whenever it changes
+
+Run 'commatrix <command> -h' for the flags of a command.
+`
+
+var commands = map[string]func(args []string) error{
+	"generate":   runGenerate,
+	"diff":       runDiff,
+	"merge":      runMerge,
+	"nft":        runNft,
+	"iptables":   runIptables,
+	"firewalld":  runFirewalld,
+	"netpol":     runNetpol,
+	"audit":      runAudit,
+	"collect":    runCollect,
+	"controller": runController,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	err := run(os.Args[2:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "commatrix %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+func runMerge(args []string) error {
+	fs, f := newFlagSet("merge", commatrix.Formats())
+	strict := fs.Bool("strict", false, "fail when the matrix files conflict")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: commatrix merge [flags] <matrix file>...")
+		fmt.Fprintln(fs.Output(), "The matrix files are given in decreasing precedence.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.validateFormat(); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one matrix file is required")
+	}
+
+	sources := make([]commatrix.Source, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		m, err := commatrix.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, commatrix.Source{Name: path, Matrix: m})
+	}
+
+	res := commatrix.Merge(sources...)
+	for _, c := range res.Conflicts {
+		fmt.Fprintln(os.Stderr, c.String())
+	}
+	if *strict && len(res.Conflicts) > 0 {
+		return fmt.Errorf("found %d conflicts", len(res.Conflicts))
+	}
+
+	out, err := formatMatrix(res.Matrix, f.format)
+	if err != nil {
+		return err
+	}
+
+	return f.write(out)
+}
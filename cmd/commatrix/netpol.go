@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/networkpolicy"
+)
+
+func runNetpol(args []string) error {
+	fs, f := newFlagSet("netpol", nil)
+	input := fs.String("input", "", "path to the matrix file, generates the matrix from the cluster when not set")
+	namespaces := fs.String("namespaces", "", "comma separated namespaces to generate policies for, defaults to all namespaces")
+	admin := fs.Bool("admin", false, "render AdminNetworkPolicies instead of NetworkPolicies")
+	opts := networkpolicy.Options{}
+	fs.StringVar(&opts.Prefix, "prefix", "commatrix-", "prefix of the policy names")
+	fs.Int64Var(&opts.AdminNetworkPolicyPriority, "priority", 50, "priority of the first AdminNetworkPolicy, between 0 and 1000")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *namespaces != "" {
+		opts.Namespaces = strings.Split(*namespaces, ",")
+	}
+
+	m, err := inputMatrix(*input, f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	cs, err := client.New(f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	policies, err := networkpolicy.Generate(cs, m, opts)
+	if err != nil {
+		return err
+	}
+
+	objects := make([]interface{}, 0, len(policies))
+	if *admin {
+		anps, err := networkpolicy.ToAdminNetworkPolicies(policies, opts)
+		if err != nil {
+			return err
+		}
+		for _, anp := range anps {
+			objects = append(objects, anp.Object)
+		}
+	} else {
+		for _, p := range policies {
+			objects = append(objects, p)
+		}
+	}
+
+	out, err := formatObjects(objects)
+	if err != nil {
+		return err
+	}
+
+	return f.write(out)
+}
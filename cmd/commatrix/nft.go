@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/nftables"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+	"github.com/liornoy/node-comm-lib/pkg/rollout"
+)
+
+func runNft(args []string) error {
+	fs, f := newFlagSet("nft", nil)
+	input := fs.String("input", "", "path to a matrix file, defaults to generating the matrix from the cluster")
+	dir := fs.String("dir", "", "write a ruleset per node role, and per node for node specific entries, to this directory")
+	policyFile := fs.String("policy", "", "path to a source policy file restricting the sources of the matrix ports")
+	defaultPolicy := fs.Bool("default-policy", false, "restrict the etcd ports to master nodes and the kubelet port to the cluster network")
+	clusterNetworks := fs.String("cluster-network", "", "comma separated cluster network CIDRs used by the source policy, overriding the cluster network config")
+	asJSON := fs.Bool("json", false, "render the ruleset in the libnftables JSON format, for nft -j -f")
+	bundle := fs.String("bundle", "", "render the rulesets per node role as machineconfig (OpenShift MachineConfigs) or daemonset (a DaemonSet and ConfigMap bundle)")
+	rolloutOpts := rollout.Options{}
+	fs.StringVar(&rolloutOpts.Namespace, "namespace", "commatrix", "namespace of the daemonset bundle")
+	fs.StringVar(&rolloutOpts.Image, "image", "registry.access.redhat.com/ubi9/ubi", "image of the daemonset bundle, providing sh and chroot")
+	opts := nftables.Options{}
+	fs.StringVar(&opts.Family, "family", "ip", "table family: ip, ip6 or inet")
+	fs.StringVar(&opts.Table, "table", "my_filter", "table name")
+	fs.StringVar(&opts.Chain, "chain", "input", "input chain name")
+	fs.IntVar(&opts.Priority, "priority", 0, "input chain priority")
+	fs.StringVar(&opts.Policy, "chain-policy", "", "input chain default policy: drop or accept, defaults to drop, or accept in audit mode")
+	fs.BoolVar(&opts.RulePerEntry, "rule-per-entry", false, "emit a rule per matrix entry, with a counter and the service name as a comment")
+	fs.BoolVar(&opts.LogDrops, "log-drops", false, "log the dropped packets with a rate limited log rule")
+	fs.StringVar(&opts.LogPrefix, "log-prefix", "", "prefix of the logged packets, defaults to \"commatrix-drop: \", or \"commatrix-audit: \" in audit mode")
+	fs.BoolVar(&opts.Audit, "audit", false, "accept all traffic, counting and logging the ports of the packets that are not in the matrix")
+	fs.StringVar(&opts.LogRate, "log-rate", "", "rate limit of the logged packets, defaults to 10/minute")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	m, err := inputMatrix(*input, f.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	if *policyFile != "" || *defaultPolicy {
+		opts.Sources, err = resolvePolicy(f.kubeconfig, *policyFile, *clusterNetworks)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *bundle != "" {
+		if *asJSON || *dir != "" {
+			return fmt.Errorf("--json and --dir are not supported with --bundle")
+		}
+		rolloutOpts.Family, rolloutOpts.Table = opts.Family, opts.Table
+		return writeBundle(m, opts, rolloutOpts, *bundle, f)
+	}
+
+	if *dir != "" {
+		if *asJSON {
+			return fmt.Errorf("--json is not supported with --dir")
+		}
+		return writeRulesToDir(m, opts, *dir)
+	}
+
+	if *asJSON {
+		out, err := nftables.GetRulesJSON(m.Matrix, opts)
+		if err != nil {
+			return err
+		}
+		return f.write(out)
+	}
+
+	rules, err := nftables.GetRules(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	return f.write([]byte(rules))
+}
+
+func resolvePolicy(kubeconfig, policyFile, clusterNetworks string) (policy.Resolved, error) {
+	p := policy.Default()
+	if policyFile != "" {
+		var err error
+		p, err = policy.LoadFile(policyFile)
+		if err != nil {
+			return policy.Resolved{}, err
+		}
+	}
+
+	networks := make([]string, 0)
+	if clusterNetworks != "" {
+		networks = strings.Split(clusterNetworks, ",")
+	}
+
+	// The cluster is only queried for rules allowing node addresses.
+	if !p.NeedsNodes() {
+		return p.Resolve(&corev1.NodeList{}, networks)
+	}
+
+	cs, err := client.New(kubeconfig)
+	if err != nil {
+		return policy.Resolved{}, err
+	}
+
+	nodes, err := cs.Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return policy.Resolved{}, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	if len(networks) == 0 && p.NeedsClusterNetworks() {
+		networks, err = policy.ClusterNetworks(context.TODO(), cs.Client)
+		if err != nil {
+			return policy.Resolved{}, err
+		}
+		if len(networks) == 0 {
+			return policy.Resolved{}, fmt.Errorf("no cluster network found in the cluster config, set it with --cluster-network")
+		}
+	}
+
+	return p.Resolve(nodes, networks)
+}
+
+func writeRulesToDir(m commatrix.ComMatrix, opts nftables.Options, dir string) error {
+	rules, err := nftables.GetRulesByRole(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	nodeRules, err := nftables.GetRulesByNode(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	for node, ruleset := range nodeRules {
+		if _, ok := rules[node]; ok {
+			return fmt.Errorf("node %s has the same name as a node role", node)
+		}
+		rules[node] = ruleset
+	}
+
+	return nftables.WriteRulesToDir(rules, dir)
+}
+
+func writeBundle(m commatrix.ComMatrix, opts nftables.Options, rolloutOpts rollout.Options, bundle string, f *commonFlags) error {
+	rules, err := nftables.GetRulesByRole(m.Matrix, opts)
+	if err != nil {
+		return err
+	}
+
+	objects := make([]interface{}, 0)
+	switch bundle {
+	case "machineconfig":
+		mcs, err := rollout.MachineConfigs(rules, rolloutOpts)
+		if err != nil {
+			return err
+		}
+		for _, mc := range mcs {
+			objects = append(objects, mc.Object)
+		}
+	case "daemonset":
+		cm, daemonSets, err := rollout.DaemonSetBundle(rules, rolloutOpts)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, cm)
+		for _, ds := range daemonSets {
+			objects = append(objects, ds)
+		}
+	default:
+		return fmt.Errorf("unsupported bundle %q", bundle)
+	}
+
+	out, err := formatObjects(objects)
+	if err != nil {
+		return err
+	}
+
+	return f.write(out)
+}
@@ -11,9 +11,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/collector"
 	"github.com/liornoy/node-comm-lib/pkg/commatrix"
 	"github.com/liornoy/node-comm-lib/pkg/consts"
-	"github.com/liornoy/node-comm-lib/pkg/ss"
 )
 
 const defaultNamespace = "default"
@@ -32,18 +32,25 @@ func main() {
 	nodeNameToNodeRoles := commatrix.GetNodesRoles(nodes)
 	nodeRolesToNodeNames := reverseMap(nodeNameToNodeRoles)
 
-	// Create ComDetails from the ss output
-	ssComDetails := make([]commatrix.ComDetails, 0)
-	for _, n := range nodes.Items {
-		nodeRole := nodeNameToNodeRoles[n.Name]
-		tcpOutput := "..." // output of `ss -anplt` on the node
-		udpOutput := "..." // output of `ss -anplu` on the node
+	// Create ComDetails from the ss output of every node
+	exec, err := collector.NewRemoteExecutor(cs)
+	if err != nil {
+		log.Fatalf("Failed creating executor: %v", err)
+	}
 
-		tcpComDetails := ss.ToComDetails(tcpOutput, nodeRole, "TCP")
-		ssComDetails = append(ssComDetails, tcpComDetails...)
+	c, err := collector.New(cs, exec, collector.Options{Namespace: defaultNamespace})
+	if err != nil {
+		log.Fatalf("Failed creating collector: %v", err)
+	}
 
-		udpComDetails := ss.ToComDetails(udpOutput, nodeRole, "UDP")
-		ssComDetails = append(ssComDetails, udpComDetails...)
+	results, err := c.Collect(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed collecting node sockets: %v", err)
+	}
+
+	ssComDetails := make([]commatrix.ComDetails, 0)
+	for _, res := range results {
+		ssComDetails = append(ssComDetails, res.ComDetails...)
 	}
 
 	// Remove duplications because some services repeat on each worker/master node.
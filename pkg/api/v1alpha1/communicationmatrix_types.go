@@ -0,0 +1,137 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// CommunicationMatrixSpec holds the entries of the matrix.
+type CommunicationMatrixSpec struct {
+	// +listType=atomic
+	// +optional
+	Entries []Entry `json:"entries,omitempty"`
+}
+
+// Entry is a port the nodes of a role listen to, see commatrix.ComDetails.
+// +kubebuilder:validation:XValidation:rule="self.protocol in ['TCP','UDP','SCTP'] ? has(self.port) : true",message="port is required for TCP, UDP and SCTP entries"
+type Entry struct {
+	// +kubebuilder:validation:Enum=ingress;egress
+	// +kubebuilder:default=ingress
+	Direction string `json:"direction"`
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP;ICMP;ICMPv6;VRRP;GRE;ESP;AH
+	Protocol string `json:"protocol"`
+	// Port is unset for the protocols without ports, e.g. VRRP.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// +kubebuilder:validation:MinLength=1
+	NodeRole string `json:"nodeRole"`
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+	Required    bool   `json:"required"`
+	// NodeName is set for entries found on a specific node.
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+// CommunicationMatrixStatus is the state of the matrix generation.
+type CommunicationMatrixStatus struct {
+	// LastGenerated is the time the entries were last generated.
+	// +optional
+	LastGenerated *metav1.Time `json:"lastGenerated,omitempty"`
+	// DriftCount is the number of entries added, removed or changed by the last generation.
+	// +optional
+	DriftCount int32 `json:"driftCount,omitempty"`
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// CommunicationMatrix is the communication matrix of the cluster.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=commatrix
+// +kubebuilder:printcolumn:name="Last Generated",type=date,JSONPath=`.status.lastGenerated`
+// +kubebuilder:printcolumn:name="Drift",type=integer,JSONPath=`.status.driftCount`
+type CommunicationMatrix struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CommunicationMatrixSpec   `json:"spec,omitempty"`
+	Status CommunicationMatrixStatus `json:"status,omitempty"`
+}
+
+// CommunicationMatrixList is a list of CommunicationMatrix.
+// +kubebuilder:object:root=true
+type CommunicationMatrixList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CommunicationMatrix `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CommunicationMatrix{}, &CommunicationMatrixList{})
+}
+
+// portProtocols are the protocols whose entries require a port, as validated by the CRD.
+var portProtocols = map[string]bool{"TCP": true, "UDP": true, "SCTP": true}
+
+// EntriesFromComMatrix converts the ComDetails of the matrix to entries.
+func EntriesFromComMatrix(m commatrix.ComMatrix) ([]Entry, error) {
+	res := make([]Entry, 0, len(m.Matrix))
+	for _, cd := range m.Matrix {
+		var port int64
+		if cd.Port == "" && portProtocols[cd.Protocol] {
+			return nil, fmt.Errorf("port is required for %s entries", cd.Protocol)
+		}
+		if cd.Port != "" {
+			var err error
+			port, err = strconv.ParseInt(cd.Port, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert port %q: %w", cd.Port, err)
+			}
+		}
+
+		res = append(res, Entry{
+			Direction:   cd.Direction,
+			Protocol:    cd.Protocol,
+			Port:        int32(port),
+			NodeRole:    cd.NodeRole,
+			ServiceName: cd.ServiceName,
+			Required:    cd.Required,
+			NodeName:    cd.NodeName,
+		})
+	}
+
+	return res, nil
+}
+
+// ToComMatrix converts the entries of the CommunicationMatrix to a ComMatrix.
+func (c *CommunicationMatrix) ToComMatrix() commatrix.ComMatrix {
+	res := commatrix.ComMatrix{Matrix: make([]commatrix.ComDetails, 0, len(c.Spec.Entries))}
+	for _, e := range c.Spec.Entries {
+		port := ""
+		if e.Port != 0 {
+			port = strconv.Itoa(int(e.Port))
+		}
+		res.Matrix = append(res.Matrix, commatrix.ComDetails{
+			Direction:   e.Direction,
+			Protocol:    e.Protocol,
+			Port:        port,
+			NodeRole:    e.NodeRole,
+			ServiceName: e.ServiceName,
+			Required:    e.Required,
+			NodeName:    e.NodeName,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,56 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+func TestComMatrixConversion(t *testing.T) {
+	m := commatrix.ComMatrix{Matrix: []commatrix.ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+		{Direction: "ingress", Protocol: "UDP", Port: "4789", NodeRole: "worker", ServiceName: "vxlan", Required: false, NodeName: "worker-0"},
+		{Direction: "ingress", Protocol: "VRRP", NodeRole: "master", ServiceName: "keepalived", Required: true},
+	}}
+
+	entries, err := EntriesFromComMatrix(m)
+	if err != nil {
+		t.Fatalf("failed to convert matrix: %s", err)
+	}
+
+	c := &CommunicationMatrix{Spec: CommunicationMatrixSpec{Entries: entries}}
+	if res := c.ToComMatrix(); !reflect.DeepEqual(res.Matrix, m.Matrix) {
+		t.Fatalf("got matrix %v, expected %v", res.Matrix, m.Matrix)
+	}
+
+	_, err = EntriesFromComMatrix(commatrix.ComMatrix{Matrix: []commatrix.ComDetails{{Port: "ssh"}}})
+	if err == nil {
+		t.Fatalf("expected an error for a non numeric port")
+	}
+
+	_, err = EntriesFromComMatrix(commatrix.ComMatrix{Matrix: []commatrix.ComDetails{{Protocol: "TCP", NodeRole: "master"}}})
+	if err == nil {
+		t.Fatalf("expected an error for a TCP entry without a port")
+	}
+
+	copied := c.DeepCopy()
+	copied.Spec.Entries[0].Port = 443
+	if c.Spec.Entries[0].Port != 6443 {
+		t.Fatalf("expected the deep copy to not share the entries")
+	}
+}
+
+func TestAddToScheme(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := AddToScheme(s); err != nil {
+		t.Fatalf("failed to add to scheme: %s", err)
+	}
+
+	gvks, _, err := s.ObjectKinds(&CommunicationMatrix{})
+	if err != nil || len(gvks) != 1 || gvks[0] != GroupVersion.WithKind("CommunicationMatrix") {
+		t.Fatalf("got kinds %v and error %v, expected %s", gvks, err, GroupVersion.WithKind("CommunicationMatrix"))
+	}
+}
@@ -0,0 +1,19 @@
+// Package v1alpha1 contains the CommunicationMatrix API.
+// +kubebuilder:object:generate=true
+// +groupName=commatrix.io
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group and version of the CommunicationMatrix API.
+	GroupVersion = schema.GroupVersion{Group: "commatrix.io", Version: "v1alpha1"}
+
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types of this group and version to a scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
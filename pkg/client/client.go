@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"k8s.io/client-go/discovery"
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	discoveryv1client "k8s.io/client-go/kubernetes/typed/discovery/v1"
@@ -17,6 +18,8 @@ type ClientSet struct {
 	appsv1client.AppsV1Interface
 	discoveryv1client.DiscoveryV1Interface
 	runtimeclient.Client
+	Config    *rest.Config
+	Discovery discovery.DiscoveryInterface
 }
 
 // New returns a *ClientBuilder with the given kubeconfig.
@@ -39,10 +42,11 @@ func New(kubeconfig string) (*ClientSet, error) {
 		return nil, fmt.Errorf("Failed to init client: %w", err)
 	}
 
-	clientSet := &ClientSet{}
+	clientSet := &ClientSet{Config: config}
 	clientSet.CoreV1Interface = corev1client.NewForConfigOrDie(config)
 	clientSet.AppsV1Interface = appsv1client.NewForConfigOrDie(config)
 	clientSet.DiscoveryV1Interface = discoveryv1client.NewForConfigOrDie(config)
+	clientSet.Discovery = discovery.NewDiscoveryClientForConfigOrDie(config)
 
 	clientSet.Client, err = runtimeclient.New(config, runtimeclient.Options{})
 
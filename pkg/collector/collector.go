@@ -0,0 +1,290 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/pointer"
+	"github.com/liornoy/node-comm-lib/pkg/ss"
+)
+
+const (
+	defaultImage       = "registry.access.redhat.com/ubi9/ubi"
+	defaultConcurrency = 5
+	defaultNodeTimeout = 2 * time.Minute
+	podNamePrefix      = "commatrix-collector-"
+	podPollInterval    = time.Second
+	hostMountPath      = "/host"
+)
+
+// Options controls how sockets are collected from the cluster nodes.
+type Options struct {
+	// Namespace where the debug pods are created, or where DaemonSet lives.
+	Namespace string
+	// Image used for the debug pods. It must provide the chroot binary.
+	Image string
+	// DaemonSet is the name of an existing DaemonSet in Namespace whose pods
+	// are used instead of creating a debug pod per node. Its pods are expected
+	// to mount the host root filesystem at /host.
+	DaemonSet string
+	// Concurrency is the maximal number of nodes collected in parallel.
+	Concurrency int
+	// NodeTimeout bounds the collection of a single node, including the debug pod startup.
+	NodeTimeout time.Duration
+}
+
+// NodeResult holds the sockets collected from a single node.
+type NodeResult struct {
+	NodeName   string
+	NodeRole   string
+	ComDetails []commatrix.ComDetails
+	Err        error
+}
+
+// NodesError is returned when the collection failed on some of the nodes.
+type NodesError struct {
+	Failed map[string]error
+}
+
+func (e *NodesError) Error() string {
+	nodes := make([]string, 0, len(e.Failed))
+	for node := range e.Failed {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	msgs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", node, e.Failed[node]))
+	}
+
+	return fmt.Sprintf("failed to collect sockets from %d nodes: %s", len(nodes), strings.Join(msgs, "; "))
+}
+
+type Collector struct {
+	cs   *client.ClientSet
+	exec Executor
+	opts Options
+}
+
+// New returns a Collector that runs the socket collection on the cluster nodes with the given Executor.
+func New(cs *client.ClientSet, exec Executor, opts Options) (*Collector, error) {
+	if cs == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+	if exec == nil {
+		return nil, fmt.Errorf("executor is nil")
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+	if opts.Image == "" {
+		opts.Image = defaultImage
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.NodeTimeout <= 0 {
+		opts.NodeTimeout = defaultNodeTimeout
+	}
+
+	return &Collector{cs: cs, exec: exec, opts: opts}, nil
+}
+
+// Collect gathers the listening sockets of every node in the cluster and returns a result per node,
+// sorted by node name. When some nodes fail, the results of all nodes are returned together with a *NodesError.
+func (c *Collector) Collect(ctx context.Context) ([]NodeResult, error) {
+	nodes, err := c.cs.Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodesRoles := commatrix.GetNodesRoles(nodes)
+
+	var dsPods map[string]*corev1.Pod
+	if c.opts.DaemonSet != "" {
+		dsPods, err = c.daemonSetPods(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, c.opts.Concurrency)
+		results = make([]NodeResult, len(nodes.Items))
+	)
+	for i, node := range nodes.Items {
+		wg.Add(1)
+		go func(i int, nodeName string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			nodeCtx, cancel := context.WithTimeout(ctx, c.opts.NodeTimeout)
+			defer cancel()
+
+			role := nodesRoles[nodeName]
+			cds, err := c.collectNode(nodeCtx, nodeName, role, dsPods)
+			results[i] = NodeResult{NodeName: nodeName, NodeRole: role, ComDetails: cds, Err: err}
+		}(i, node.Name)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].NodeName < results[j].NodeName
+	})
+
+	failed := make(map[string]error)
+	for _, res := range results {
+		if res.Err != nil {
+			failed[res.NodeName] = res.Err
+		}
+	}
+	if len(failed) > 0 {
+		return results, &NodesError{Failed: failed}
+	}
+
+	return results, nil
+}
+
+func (c *Collector) collectNode(ctx context.Context, nodeName, role string, dsPods map[string]*corev1.Pod) ([]commatrix.ComDetails, error) {
+	pod, ok := dsPods[nodeName]
+	if c.opts.DaemonSet != "" && !ok {
+		return nil, fmt.Errorf("no running pod of daemonset %s on node", c.opts.DaemonSet)
+	}
+
+	if c.opts.DaemonSet == "" {
+		var err error
+		pod, err = c.createDebugPod(ctx, nodeName)
+		if err != nil {
+			return nil, err
+		}
+		defer c.deleteDebugPod(pod)
+	}
+
+	out, err := c.exec.Exec(ctx, pod, []string{"chroot", hostMountPath, "ss", "-tuanpSH"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ss on pod %s: %w", pod.Name, err)
+	}
+
+	cds := ss.CombinedToComDetails(out, role)
+	for i := range cds {
+		cds[i].NodeName = nodeName
+	}
+
+	return cds, nil
+}
+
+func (c *Collector) daemonSetPods(ctx context.Context) (map[string]*corev1.Pod, error) {
+	ds, err := c.cs.DaemonSets(c.opts.Namespace).Get(ctx, c.opts.DaemonSet, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daemonset %s: %w", c.opts.DaemonSet, err)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of daemonset %s: %w", c.opts.DaemonSet, err)
+	}
+
+	pods, err := c.cs.Pods(c.opts.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of daemonset %s: %w", c.opts.DaemonSet, err)
+	}
+
+	res := make(map[string]*corev1.Pod)
+	for i, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		res[pod.Spec.NodeName] = &pods.Items[i]
+	}
+
+	return res, nil
+}
+
+func (c *Collector) createDebugPod(ctx context.Context, nodeName string) (*corev1.Pod, error) {
+	// The name is generated, so a pod left over by an interrupted collection does not block the node.
+	pod := debugPod(podNamePrefix+nodeName+"-", c.opts.Namespace, nodeName, c.opts.Image)
+
+	pod, err := c.cs.Pods(c.opts.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create debug pod: %w", err)
+	}
+
+	created := pod
+	err = wait.PollUntilContextCancel(ctx, podPollInterval, true, func(ctx context.Context) (bool, error) {
+		created, err = c.cs.Pods(c.opts.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if created.Status.Phase == corev1.PodFailed || created.Status.Phase == corev1.PodSucceeded {
+			return false, fmt.Errorf("debug pod %s terminated with phase %s", pod.Name, created.Status.Phase)
+		}
+
+		return created.Status.Phase == corev1.PodRunning, nil
+	})
+	if err != nil {
+		c.deleteDebugPod(pod)
+		return nil, fmt.Errorf("debug pod %s is not running: %w", pod.Name, err)
+	}
+
+	return created, nil
+}
+
+// deleteDebugPod uses its own context so that the cleanup happens even when the node timeout has expired.
+func (c *Collector) deleteDebugPod(pod *corev1.Pod) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.NodeTimeout)
+	defer cancel()
+
+	_ = c.cs.Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: pointer.Int64Ptr(0)})
+}
+
+func debugPod(generateName, namespace, nodeName, image string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: generateName,
+			Namespace:    namespace,
+			Labels:       map[string]string{consts.CollectorLabel: ""},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      nodeName,
+			HostNetwork:   true,
+			HostPID:       true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{
+				{
+					Name:    "collector",
+					Image:   image,
+					Command: []string{"sleep", "3600"},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: pointer.BoolPtr(true),
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "host", MountPath: hostMountPath},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "host",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+)
+
+const ssOutput = `tcp   LISTEN 0      4096         0.0.0.0:10250      0.0.0.0:*    users:(("kubelet",pid=1,fd=1))
+tcp   LISTEN 0      4096       127.0.0.1:10248      0.0.0.0:*    users:(("kubelet",pid=1,fd=2))
+tcp   LISTEN 0      128          0.0.0.0:22         0.0.0.0:*    users:(("sshd",pid=2,fd=3))
+udp   ESTAB  0      0           10.0.0.1:6081      10.0.0.2:6081 users:(("ovs-vswitchd",pid=3,fd=4))
+`
+
+type fakeExecutor struct {
+	mu       sync.Mutex
+	failNode string
+	commands map[string]int
+}
+
+func (e *fakeExecutor) Exec(ctx context.Context, pod *corev1.Pod, command []string) (string, error) {
+	e.mu.Lock()
+	e.commands[pod.Spec.NodeName]++
+	e.mu.Unlock()
+
+	if pod.Spec.NodeName == e.failNode {
+		return "", fmt.Errorf("exec failed")
+	}
+
+	return ssOutput, nil
+}
+
+func newNode(name, role string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{role: ""},
+		},
+	}
+}
+
+func newClientSet(objects ...runtime.Object) (*client.ClientSet, *fake.Clientset) {
+	fakeCS := fake.NewSimpleClientset(objects...)
+	// The fake clientset has no kubelet, so debug pods are marked as running once created. It does not
+	// generate names either, so the generated names are emulated.
+	var generated int
+	fakeCS.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		if pod.Name == "" && pod.GenerateName != "" {
+			generated++
+			pod.Name = fmt.Sprintf("%s%05d", pod.GenerateName, generated)
+		}
+		pod.Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+
+	return &client.ClientSet{
+		CoreV1Interface: fakeCS.CoreV1(),
+		AppsV1Interface: fakeCS.AppsV1(),
+	}, fakeCS
+}
+
+func TestNewNilArguments(t *testing.T) {
+	cs, _ := newClientSet()
+
+	if _, err := New(nil, &fakeExecutor{}, Options{}); err == nil {
+		t.Fatalf("expected error for nil client")
+	}
+
+	if _, err := New(cs, nil, Options{}); err == nil {
+		t.Fatalf("expected error for nil executor")
+	}
+}
+
+func TestCollectDebugPods(t *testing.T) {
+	cs, _ := newClientSet(newNode("master-0", consts.MasterRole), newNode("worker-0", consts.WorkerRole))
+	exec := &fakeExecutor{commands: map[string]int{}}
+
+	c, err := New(cs, exec, Options{Namespace: consts.TestNameSpace, NodeTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("failed to create collector: %s", err)
+	}
+
+	results, err := c.Collect(context.TODO())
+	if err != nil {
+		t.Fatalf("failed to collect: %s", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, expected 2", len(results))
+	}
+
+	for _, res := range results {
+		if exec.commands[res.NodeName] != 1 {
+			t.Fatalf("node %s: got %d commands, expected 1", res.NodeName, exec.commands[res.NodeName])
+		}
+		// kubelet and sshd over TCP, ovs-vswitchd over UDP.
+		if len(res.ComDetails) != 3 {
+			t.Fatalf("node %s: got %d ComDetails, expected 3", res.NodeName, len(res.ComDetails))
+		}
+		for _, cd := range res.ComDetails {
+			if cd.NodeRole != res.NodeRole {
+				t.Fatalf("node %s: got role %s, expected %s", res.NodeName, cd.NodeRole, res.NodeRole)
+			}
+		}
+	}
+
+	if results[0].NodeRole != "master" || results[1].NodeRole != "worker" {
+		t.Fatalf("got roles %s and %s, expected master and worker", results[0].NodeRole, results[1].NodeRole)
+	}
+
+	pods, err := cs.Pods(consts.TestNameSpace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list pods: %s", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Fatalf("got %d debug pods left, expected 0", len(pods.Items))
+	}
+}
+
+func TestCollectStaleDebugPod(t *testing.T) {
+	stale := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: podNamePrefix + "worker-0", Namespace: consts.TestNameSpace}}
+	cs, _ := newClientSet(newNode("worker-0", consts.WorkerRole), stale)
+
+	c, err := New(cs, &fakeExecutor{commands: map[string]int{}}, Options{Namespace: consts.TestNameSpace})
+	if err != nil {
+		t.Fatalf("failed to create collector: %s", err)
+	}
+
+	results, err := c.Collect(context.TODO())
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the collection to ignore the stale pod, got %+v (err: %v)", results, err)
+	}
+}
+
+func TestCollectPartialFailure(t *testing.T) {
+	cs, _ := newClientSet(newNode("master-0", consts.MasterRole), newNode("worker-0", consts.WorkerRole))
+	exec := &fakeExecutor{commands: map[string]int{}, failNode: "worker-0"}
+
+	c, err := New(cs, exec, Options{Namespace: consts.TestNameSpace, Concurrency: 1})
+	if err != nil {
+		t.Fatalf("failed to create collector: %s", err)
+	}
+
+	results, err := c.Collect(context.TODO())
+	var nodesErr *NodesError
+	if !errors.As(err, &nodesErr) {
+		t.Fatalf("got error %v, expected *NodesError", err)
+	}
+
+	if _, ok := nodesErr.Failed["worker-0"]; !ok || len(nodesErr.Failed) != 1 {
+		t.Fatalf("got failed nodes %v, expected worker-0 only", nodesErr.Failed)
+	}
+
+	if len(results) != 2 || results[0].Err != nil || len(results[0].ComDetails) != 3 {
+		t.Fatalf("expected master-0 results to be returned despite worker-0 failure, got %+v", results)
+	}
+}
+
+func TestCollectDaemonSet(t *testing.T) {
+	var (
+		labels = map[string]string{"app": "collector"}
+		ds     = &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "collector", Namespace: consts.TestNameSpace},
+			Spec: appsv1.DaemonSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+			},
+		}
+		dsPod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "collector-abcde", Namespace: consts.TestNameSpace, Labels: labels},
+			Spec: corev1.PodSpec{
+				NodeName:   "worker-0",
+				Containers: []corev1.Container{{Name: "collector"}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	)
+	cs, fakeCS := newClientSet(newNode("master-0", consts.MasterRole), newNode("worker-0", consts.WorkerRole), ds, dsPod)
+	exec := &fakeExecutor{commands: map[string]int{}}
+
+	c, err := New(cs, exec, Options{Namespace: consts.TestNameSpace, DaemonSet: "collector"})
+	if err != nil {
+		t.Fatalf("failed to create collector: %s", err)
+	}
+
+	results, err := c.Collect(context.TODO())
+	var nodesErr *NodesError
+	if !errors.As(err, &nodesErr) {
+		t.Fatalf("got error %v, expected *NodesError", err)
+	}
+
+	if _, ok := nodesErr.Failed["master-0"]; !ok || len(nodesErr.Failed) != 1 {
+		t.Fatalf("got failed nodes %v, expected master-0 only", nodesErr.Failed)
+	}
+
+	if len(results[1].ComDetails) != 3 {
+		t.Fatalf("got %d ComDetails for worker-0, expected 3", len(results[1].ComDetails))
+	}
+
+	for _, action := range fakeCS.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "delete" {
+			t.Fatalf("unexpected %s action in daemonset mode", action.GetVerb())
+		}
+	}
+}
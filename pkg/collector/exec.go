@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+)
+
+// Executor runs a command inside the first container of a pod and returns its standard output.
+type Executor interface {
+	Exec(ctx context.Context, pod *corev1.Pod, command []string) (string, error)
+}
+
+type remoteExecutor struct {
+	cs *client.ClientSet
+}
+
+// NewRemoteExecutor returns an Executor that runs commands through the pods/exec API.
+func NewRemoteExecutor(cs *client.ClientSet) (Executor, error) {
+	if cs == nil || cs.Config == nil {
+		return nil, fmt.Errorf("client rest config is nil")
+	}
+
+	return &remoteExecutor{cs: cs}, nil
+}
+
+func (e *remoteExecutor) Exec(ctx context.Context, pod *corev1.Pod, command []string) (string, error) {
+	if len(pod.Spec.Containers) == 0 {
+		return "", fmt.Errorf("pod %s/%s has no containers", pod.Namespace, pod.Name)
+	}
+
+	req := e.cs.CoreV1Interface.RESTClient().
+		Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: pod.Spec.Containers[0].Name,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.cs.Config, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to exec %v: %w: %s", command, err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
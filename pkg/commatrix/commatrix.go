@@ -1,13 +1,9 @@
 package commatrix
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"os"
-	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -20,7 +16,9 @@ import (
 )
 
 type ComMatrix struct {
-	Matrix []ComDetails
+	// Metadata describes where the matrix came from. It is nil for matrices that were not created from a cluster.
+	Metadata *Metadata    `json:"metadata,omitempty"`
+	Matrix   []ComDetails `json:"matrix"`
 }
 
 type ComDetails struct {
@@ -30,6 +28,8 @@ type ComDetails struct {
 	NodeRole    string `json:"nodeRole"`
 	ServiceName string `json:"serviceName"`
 	Required    bool   `json:"required"`
+	// NodeName is set for ComDetails that were found on a specific node, e.g. by collecting its sockets.
+	NodeName string `json:"nodeName,omitempty"`
 }
 
 func (cd ComDetails) String() string {
@@ -70,7 +70,8 @@ func (m ComMatrix) String() string {
 	return result.String()
 }
 
-func CreateComMatrix(cs *client.ClientSet, epSlices []discoveryv1.EndpointSlice) (ComMatrix, error) {
+// CreateComMatrix creates the ComMatrix of the EndpointSlices, and applies the overlays to it in order.
+func CreateComMatrix(cs *client.ClientSet, epSlices []discoveryv1.EndpointSlice, overlays ...Overlay) (ComMatrix, error) {
 	if len(epSlices) == 0 {
 		return ComMatrix{}, fmt.Errorf("failed to create ComMatrix: epSlices is empty")
 	}
@@ -88,8 +89,19 @@ func CreateComMatrix(cs *client.ClientSet, epSlices []discoveryv1.EndpointSlice)
 		comDetails = append(comDetails, cd...)
 	}
 
+	metadata, err := NewMetadata(cs, nodes)
+	if err != nil {
+		return ComMatrix{}, fmt.Errorf("failed to create ComMatrix: %w", err)
+	}
+
 	cleanedComDetails := RemoveDups(comDetails)
-	res := ComMatrix{Matrix: cleanedComDetails}
+	res := ComMatrix{Metadata: metadata, Matrix: cleanedComDetails}
+	for _, o := range overlays {
+		if err := o.Validate(); err != nil {
+			return ComMatrix{}, fmt.Errorf("failed to apply overlay: %w", err)
+		}
+		res = o.Apply(res)
+	}
 
 	return res, nil
 }
@@ -120,25 +132,14 @@ func createComDetails(epSlice discoveryv1.EndpointSlice, nodesRoles map[string]s
 	return res
 }
 
-func (m ComMatrix) ToCSV() ([]byte, error) {
-	out := make([]byte, 0)
-	w := bytes.NewBuffer(out)
-	csvwriter := csv.NewWriter(w)
-
-	for _, cd := range m.Matrix {
-		record := strings.Split(cd.String(), ",")
-		err := csvwriter.Write(record)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert to CSV foramt: %w", err)
-		}
+// ToJSON returns the matrix as a JSON object with the metadata and matrix fields. The metadata
+// field is omitted when the matrix has no metadata.
+func (m ComMatrix) ToJSON() ([]byte, error) {
+	if m.Matrix == nil {
+		m.Matrix = []ComDetails{}
 	}
-	csvwriter.Flush()
 
-	return w.Bytes(), nil
-}
-
-func (m ComMatrix) ToJSON() ([]byte, error) {
-	out, err := json.Marshal(m.Matrix)
+	out, err := json.Marshal(m)
 	if err != nil {
 		return nil, err
 	}
@@ -204,21 +205,5 @@ func (m ComMatrix) Diff(other ComMatrix, ignorePorts map[string]bool) ComMatrix
 		}
 	}
 
-	return ComMatrix{Matrix: diff}
-}
-
-func (m ComMatrix) WriteTo(f *os.File) error {
-	sorted := m.Matrix
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].ServiceName < sorted[j].ServiceName
-	})
-
-	for _, cd := range sorted {
-		_, err := f.Write([]byte(fmt.Sprintln(cd)))
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return ComMatrix{Metadata: m.Metadata, Matrix: diff}
 }
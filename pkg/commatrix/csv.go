@@ -0,0 +1,171 @@
+package commatrix
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+)
+
+// CSVSchemaVersion is the version of the CSV columns written by ToCSV. It is increased whenever
+// the meaning of an existing column changes, so loaders can reject files they do not understand.
+const CSVSchemaVersion = 1
+
+// CSV column names, matching the JSON field names.
+const (
+	ColumnDirection     = "direction"
+	ColumnProtocol      = "protocol"
+	ColumnPort          = "port"
+	ColumnNodeRole      = "nodeRole"
+	ColumnServiceName   = "serviceName"
+	ColumnRequired      = "required"
+	ColumnNodeName      = "nodeName"
+	ColumnSchemaVersion = "schemaVersion"
+)
+
+// DefaultCSVColumns are the columns written by ToCSV.
+var DefaultCSVColumns = []string{
+	ColumnDirection, ColumnProtocol, ColumnPort, ColumnNodeRole, ColumnServiceName, ColumnRequired, ColumnNodeName, ColumnSchemaVersion,
+}
+
+// legacyCSVColumns are the columns of the CSV files written without a header row.
+var legacyCSVColumns = []string{ColumnDirection, ColumnProtocol, ColumnPort, ColumnNodeRole, ColumnServiceName, ColumnRequired}
+
+type csvColumn struct {
+	get func(cd ComDetails) string
+	set func(cd *ComDetails, value string) error
+}
+
+var csvColumns = map[string]csvColumn{
+	ColumnDirection: {
+		get: func(cd ComDetails) string { return cd.Direction },
+		set: func(cd *ComDetails, v string) error { cd.Direction = v; return nil },
+	},
+	ColumnProtocol: {
+		get: func(cd ComDetails) string { return cd.Protocol },
+		set: func(cd *ComDetails, v string) error { cd.Protocol = v; return nil },
+	},
+	ColumnPort: {
+		get: func(cd ComDetails) string { return cd.Port },
+		set: func(cd *ComDetails, v string) error { cd.Port = v; return nil },
+	},
+	ColumnNodeRole: {
+		get: func(cd ComDetails) string { return cd.NodeRole },
+		set: func(cd *ComDetails, v string) error { cd.NodeRole = v; return nil },
+	},
+	ColumnServiceName: {
+		get: func(cd ComDetails) string { return cd.ServiceName },
+		set: func(cd *ComDetails, v string) error { cd.ServiceName = v; return nil },
+	},
+	ColumnRequired: {
+		get: func(cd ComDetails) string { return strconv.FormatBool(cd.Required) },
+		set: func(cd *ComDetails, v string) error {
+			required, err := strconv.ParseBool(v)
+			cd.Required = required
+			return err
+		},
+	},
+	ColumnNodeName: {
+		get: func(cd ComDetails) string { return cd.NodeName },
+		set: func(cd *ComDetails, v string) error { cd.NodeName = v; return nil },
+	},
+	ColumnSchemaVersion: {
+		get: func(cd ComDetails) string { return strconv.Itoa(CSVSchemaVersion) },
+		set: func(cd *ComDetails, v string) error {
+			version, err := strconv.Atoi(v)
+			if err != nil || version < 1 || version > CSVSchemaVersion {
+				return fmt.Errorf("unsupported schema version %q", v)
+			}
+			return nil
+		},
+	},
+}
+
+// ToCSV returns the matrix as CSV with a header row and the DefaultCSVColumns.
+func (m ComMatrix) ToCSV() ([]byte, error) {
+	return m.ToCSVWithColumns(DefaultCSVColumns)
+}
+
+// ToCSVWithColumns returns the matrix as CSV with a header row and the given columns, in order.
+func (m ComMatrix) ToCSVWithColumns(columns []string) ([]byte, error) {
+	getters := make([]func(ComDetails) string, 0, len(columns))
+	for _, name := range columns {
+		c, ok := csvColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		getters = append(getters, c.get)
+	}
+
+	w := bytes.NewBuffer(make([]byte, 0))
+	csvwriter := csv.NewWriter(w)
+
+	records := [][]string{columns}
+	for _, cd := range m.Matrix {
+		record := make([]string, 0, len(getters))
+		for _, get := range getters {
+			record = append(record, get(cd))
+		}
+		records = append(records, record)
+	}
+
+	err := csvwriter.WriteAll(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to CSV format: %w", err)
+	}
+
+	return w.Bytes(), nil
+}
+
+// FromCSV parses a ComMatrix in the format produced by ToCSV or ToCSVWithColumns. Files without
+// a header row are parsed with the direction, protocol, port, nodeRole, serviceName and required columns.
+func FromCSV(data []byte) (ComMatrix, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return ComMatrix{}, fmt.Errorf("failed to parse CSV matrix: %w", err)
+	}
+
+	columns := legacyCSVColumns
+	first := 0
+	if len(records) > 0 && isCSVHeader(records[0]) {
+		columns = records[0]
+		first = 1
+	}
+
+	setters := make([]func(*ComDetails, string) error, 0, len(columns))
+	for _, name := range columns {
+		c, ok := csvColumns[name]
+		if !ok {
+			return ComMatrix{}, fmt.Errorf("failed to parse CSV matrix: unknown column %q", name)
+		}
+		setters = append(setters, c.set)
+	}
+
+	cds := make([]ComDetails, 0, len(records))
+	for i, record := range records[first:] {
+		line := first + i + 1
+		if len(record) != len(columns) {
+			return ComMatrix{}, fmt.Errorf("failed to parse CSV matrix: line %d has %d fields, expected %d", line, len(record), len(columns))
+		}
+
+		var cd ComDetails
+		for j, set := range setters {
+			if err := set(&cd, record[j]); err != nil {
+				return ComMatrix{}, fmt.Errorf("failed to parse CSV matrix: line %d: column %s: %w", line, columns[j], err)
+			}
+		}
+		cds = append(cds, cd)
+	}
+
+	return ComMatrix{Matrix: cds}, nil
+}
+
+// isCSVHeader returns whether the record is a header row, i.e. it starts with a column name.
+func isCSVHeader(record []string) bool {
+	if len(record) == 0 {
+		return false
+	}
+	_, ok := csvColumns[record[0]]
+
+	return ok
+}
@@ -0,0 +1,204 @@
+package commatrix
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Formatter renders a ComMatrix in an output format.
+type Formatter interface {
+	Format(m ComMatrix) ([]byte, error)
+}
+
+// FormatterFunc adapts a function to the Formatter interface.
+type FormatterFunc func(m ComMatrix) ([]byte, error)
+
+func (f FormatterFunc) Format(m ComMatrix) ([]byte, error) {
+	return f(m)
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		"csv":      FormatterFunc(ComMatrix.ToCSV),
+		"json":     FormatterFunc(ComMatrix.ToJSON),
+		"yaml":     FormatterFunc(ComMatrix.ToYAML),
+		"table":    FormatterFunc(ComMatrix.ToTable),
+		"markdown": FormatterFunc(ComMatrix.ToMarkdown),
+		"html":     FormatterFunc(ComMatrix.ToHTML),
+	}
+)
+
+var matrixHeader = []string{"DIRECTION", "PROTOCOL", "PORT", "NODE ROLE", "NODE", "SERVICE", "REQUIRED"}
+
+// markdownEscaper escapes the characters that would break a Markdown table cell.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// RegisterFormatter registers a formatter by name, replacing the formatter registered with the same name.
+func RegisterFormatter(name string, f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+
+	formatters[name] = f
+}
+
+// GetFormatter returns the formatter registered with the name.
+func GetFormatter(name string) (Formatter, error) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q", name)
+	}
+
+	return f, nil
+}
+
+// Formats returns the sorted names of the registered formatters.
+func Formats() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	res := make([]string, 0, len(formatters))
+	for name := range formatters {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// ToYAML returns the matrix in the YAML form of its JSON format.
+func (m ComMatrix) ToYAML() ([]byte, error) {
+	out, err := m.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.JSONToYAML(out)
+}
+
+// ToTable returns the matrix as a human readable table.
+func (m ComMatrix) ToTable() ([]byte, error) {
+	w := bytes.NewBuffer(make([]byte, 0))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(matrixHeader, "\t"))
+	for _, cd := range m.Matrix {
+		fmt.Fprintln(tw, strings.Join(cd.record(), "\t"))
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to table format: %w", err)
+	}
+
+	return w.Bytes(), nil
+}
+
+// ToMarkdown returns the matrix as a Markdown table.
+func (m ComMatrix) ToMarkdown() ([]byte, error) {
+	w := bytes.NewBuffer(make([]byte, 0))
+
+	fmt.Fprintf(w, "| %s |\n", strings.Join([]string{"Direction", "Protocol", "Port", "Node Role", "Node", "Service", "Required"}, " | "))
+	fmt.Fprintln(w, "|---|---|---|---|---|---|---|")
+	for _, cd := range m.Matrix {
+		record := cd.record()
+		for i, field := range record {
+			record[i] = markdownEscaper.Replace(field)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(record, " | "))
+	}
+
+	return w.Bytes(), nil
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Communication Matrix</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 12px; text-align: left; }
+th { background: #eee; cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>Communication Matrix</h1>
+{{- range .}}
+<h2>{{.Role}}</h2>
+<table class="sortable">
+<thead><tr><th>Direction</th><th>Protocol</th><th>Port</th><th>Node</th><th>Service</th><th>Required</th></tr></thead>
+<tbody>
+{{- range .ComDetails}}
+<tr><td>{{.Direction}}</td><td>{{.Protocol}}</td><td>{{.Port}}</td><td>{{.NodeName}}</td><td>{{.ServiceName}}</td><td>{{.Required}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+<script>
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table"), tbody = table.tBodies[0];
+    var col = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var asc = th.dataset.order !== "asc";
+    th.parentNode.querySelectorAll("th").forEach(function (h) { delete h.dataset.order; });
+    th.dataset.order = asc ? "asc" : "desc";
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[col].textContent, y = b.cells[col].textContent;
+      var cmp = (!isNaN(x) && !isNaN(y)) ? x - y : x.localeCompare(y);
+      return asc ? cmp : -cmp;
+    });
+    rows.forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`
+
+var htmlTmpl = template.Must(template.New("htmlTemplate").Parse(htmlTemplate))
+
+type htmlRoleGroup struct {
+	Role       string
+	ComDetails []ComDetails
+}
+
+// ToHTML returns the matrix as a standalone HTML report, with a table per node role whose columns
+// are sorted by clicking their headers.
+func (m ComMatrix) ToHTML() ([]byte, error) {
+	byRole := make(map[string][]ComDetails)
+	for _, cd := range m.Matrix {
+		byRole[cd.NodeRole] = append(byRole[cd.NodeRole], cd)
+	}
+	groups := make([]htmlRoleGroup, 0, len(byRole))
+	for role, cds := range byRole {
+		groups = append(groups, htmlRoleGroup{Role: role, ComDetails: cds})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Role < groups[j].Role
+	})
+
+	var out bytes.Buffer
+	err := htmlTmpl.Execute(&out, groups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to HTML format: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+func (cd ComDetails) record() []string {
+	return []string{cd.Direction, cd.Protocol, cd.Port, cd.NodeRole, cd.NodeName, cd.ServiceName, fmt.Sprint(cd.Required)}
+}
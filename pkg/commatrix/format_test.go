@@ -0,0 +1,78 @@
+package commatrix
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatters(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+		{Direction: "ingress", Protocol: "UDP", Port: "111", NodeRole: "worker", ServiceName: "<rpc|bind>", Required: false},
+		{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", NodeName: "worker-0", ServiceName: "node\nexporter", Required: true},
+	}}
+
+	tests := []struct {
+		format   string
+		contains []string
+	}{
+		{
+			format: "markdown",
+			contains: []string{
+				"| Direction | Protocol | Port | Node Role | Node | Service | Required |",
+				"| ingress | UDP | 111 | worker |  | <rpc\\|bind> | false |",
+				"| ingress | TCP | 9100 | worker | worker-0 | node<br>exporter | true |",
+			},
+		},
+		{
+			format:   "html",
+			contains: []string{"<h2>master</h2>", "<h2>worker</h2>", "<td>&lt;rpc|bind&gt;</td>", "<td>worker-0</td>", "table.sortable"},
+		},
+		{
+			format:   "yaml",
+			contains: []string{"matrix:\n- direction: ingress\n  nodeRole: master\n  port: \"6443\""},
+		},
+		{
+			format:   "table",
+			contains: []string{"DIRECTION  PROTOCOL  PORT  NODE ROLE  NODE      SERVICE", "worker     worker-0  node"},
+		},
+	}
+
+	for _, test := range tests {
+		f, err := GetFormatter(test.format)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.format, err)
+		}
+
+		out, err := f.Format(m)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.format, err)
+		}
+
+		for _, s := range test.contains {
+			if !strings.Contains(string(out), s) {
+				t.Fatalf("test \"%s\" failed: output is missing %q:\n%s", test.format, s, out)
+			}
+		}
+	}
+}
+
+func TestRegisterFormatter(t *testing.T) {
+	if _, err := GetFormatter("count"); err == nil {
+		t.Fatalf("expected error for unregistered format")
+	}
+
+	RegisterFormatter("count", FormatterFunc(func(m ComMatrix) ([]byte, error) {
+		return []byte(strings.Repeat("x", len(m.Matrix))), nil
+	}))
+
+	f, err := GetFormatter("count")
+	if err != nil {
+		t.Fatalf("failed to get registered formatter: %s", err)
+	}
+
+	out, err := f.Format(ComMatrix{Matrix: make([]ComDetails, 3)})
+	if err != nil || string(out) != "xxx" {
+		t.Fatalf("got %q (err: %v), expected \"xxx\"", out, err)
+	}
+}
@@ -0,0 +1,55 @@
+package commatrix
+
+import "fmt"
+
+// GroupByRole returns the ComDetails of every node role that are not bound to any node.
+// ComDetails with their NodeName set are only grouped by GroupByNode, so a port found on
+// a single node is not opened on the other nodes of its role.
+func GroupByRole(cds []ComDetails) map[string][]ComDetails {
+	res := make(map[string][]ComDetails)
+	for _, cd := range cds {
+		if cd.NodeName != "" {
+			continue
+		}
+		res[cd.NodeRole] = append(res[cd.NodeRole], cd)
+	}
+
+	return res
+}
+
+// RequireNodeRoles returns an error if any of the ComDetails has no node role, e.g. when it was
+// created from an EndpointSlice of a node that is neither a master nor a worker.
+func RequireNodeRoles(cds []ComDetails) error {
+	for _, cd := range cds {
+		if cd.NodeRole == "" {
+			return fmt.Errorf("%s %s/%s has no node role", cd.ServiceName, cd.Protocol, cd.Port)
+		}
+	}
+
+	return nil
+}
+
+// GroupByNode returns the ComDetails of every node that has ComDetails with its NodeName set.
+// The ComDetails of a node are the ComDetails of its role that are not bound to any node, followed by its own.
+func GroupByNode(cds []ComDetails) map[string][]ComDetails {
+	var (
+		roleRows  = make(map[string][]ComDetails)
+		nodeRows  = make(map[string][]ComDetails)
+		nodeRoles = make(map[string]string)
+	)
+	for _, cd := range cds {
+		if cd.NodeName == "" {
+			roleRows[cd.NodeRole] = append(roleRows[cd.NodeRole], cd)
+			continue
+		}
+		nodeRows[cd.NodeName] = append(nodeRows[cd.NodeName], cd)
+		nodeRoles[cd.NodeName] = cd.NodeRole
+	}
+
+	res := make(map[string][]ComDetails)
+	for node, rows := range nodeRows {
+		res[node] = append(append([]ComDetails{}, roleRows[nodeRoles[node]]...), rows...)
+	}
+
+	return res
+}
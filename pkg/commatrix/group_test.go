@@ -0,0 +1,32 @@
+package commatrix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupByRoleAndNode(t *testing.T) {
+	var (
+		kubelet = ComDetails{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true}
+		worker0 = ComDetails{Direction: "ingress", Protocol: "TCP", Port: "9999", NodeRole: "worker", ServiceName: "debug", Required: true, NodeName: "worker-0"}
+		api     = ComDetails{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true}
+		cds     = []ComDetails{kubelet, worker0, api}
+	)
+
+	expectedByRole := map[string][]ComDetails{"worker": {kubelet}, "master": {api}}
+	if res := GroupByRole(cds); !reflect.DeepEqual(res, expectedByRole) {
+		t.Fatalf("got roles %v, expected %v", res, expectedByRole)
+	}
+
+	expectedByNode := map[string][]ComDetails{"worker-0": {kubelet, worker0}}
+	if res := GroupByNode(cds); !reflect.DeepEqual(res, expectedByNode) {
+		t.Fatalf("got nodes %v, expected %v", res, expectedByNode)
+	}
+
+	if err := RequireNodeRoles(cds); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := RequireNodeRoles(append(cds, ComDetails{Protocol: "TCP", Port: "80"})); err == nil {
+		t.Fatalf("expected an error for a ComDetails without node role")
+	}
+}
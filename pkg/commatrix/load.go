@@ -0,0 +1,61 @@
+package commatrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// LoadFile reads a ComMatrix from a file, detecting the format from its extension (.csv, .json, .yaml or .yml).
+func LoadFile(path string) (ComMatrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ComMatrix{}, fmt.Errorf("failed to read matrix file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".csv":
+		return FromCSV(data)
+	case ".json":
+		return FromJSON(data)
+	case ".yaml", ".yml":
+		return FromYAML(data)
+	}
+
+	return ComMatrix{}, fmt.Errorf("unsupported matrix file extension %q", filepath.Ext(path))
+}
+
+// FromJSON parses a ComMatrix in the format produced by ToJSON, or in the legacy format of
+// a JSON array of ComDetails.
+func FromJSON(data []byte) (ComMatrix, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var m ComMatrix
+		err := json.Unmarshal(data, &m)
+		if err != nil {
+			return ComMatrix{}, fmt.Errorf("failed to parse JSON matrix: %w", err)
+		}
+		return m, nil
+	}
+
+	var cds []ComDetails
+	err := json.Unmarshal(data, &cds)
+	if err != nil {
+		return ComMatrix{}, fmt.Errorf("failed to parse JSON matrix: %w", err)
+	}
+
+	return ComMatrix{Matrix: cds}, nil
+}
+
+// FromYAML parses a ComMatrix in YAML format, with the same fields as the JSON format.
+func FromYAML(data []byte) (ComMatrix, error) {
+	out, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return ComMatrix{}, fmt.Errorf("failed to parse YAML matrix: %w", err)
+	}
+
+	return FromJSON(out)
+}
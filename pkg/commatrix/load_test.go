@@ -0,0 +1,95 @@
+package commatrix
+
+import (
+	"testing"
+)
+
+func TestLoadRoundTrip(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+		{Direction: "ingress", Protocol: "UDP", Port: "111", NodeRole: "worker", ServiceName: "rpcbind, statd", Required: false, NodeName: "worker-0"},
+	}}
+
+	csvOut, err := m.ToCSV()
+	if err != nil {
+		t.Fatalf("failed to convert to CSV: %s", err)
+	}
+	jsonOut, err := m.ToJSON()
+	if err != nil {
+		t.Fatalf("failed to convert to JSON: %s", err)
+	}
+
+	tests := []struct {
+		desc string
+		load func([]byte) (ComMatrix, error)
+		data []byte
+	}{
+		{desc: "csv", load: FromCSV, data: csvOut},
+		{desc: "json", load: FromJSON, data: jsonOut},
+		{desc: "legacy json", load: FromJSON, data: []byte(`[{"direction": "ingress", "protocol": "TCP", "port": "6443", "nodeRole": "master", "serviceName": "kubernetes", "required": true},
+			{"direction": "ingress", "protocol": "UDP", "port": "111", "nodeRole": "worker", "serviceName": "rpcbind, statd", "required": false, "nodeName": "worker-0"}]`)},
+		{desc: "legacy yaml", load: FromYAML, data: []byte("- direction: ingress\n  protocol: TCP\n  port: \"6443\"\n  nodeRole: master\n  serviceName: kubernetes\n  required: true\n- direction: ingress\n  protocol: UDP\n  port: \"111\"\n  nodeRole: worker\n  serviceName: rpcbind, statd\n  required: false\n  nodeName: worker-0\n")},
+	}
+
+	for _, test := range tests {
+		res, err := test.load(test.data)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.desc, err)
+		}
+		if len(res.Matrix) != len(m.Matrix) {
+			t.Fatalf("test \"%s\" failed: got %d ComDetails, expected %d", test.desc, len(res.Matrix), len(m.Matrix))
+		}
+		for i := range m.Matrix {
+			if res.Matrix[i] != m.Matrix[i] {
+				t.Fatalf("test \"%s\" failed: got %v, expected %v", test.desc, res.Matrix[i], m.Matrix[i])
+			}
+		}
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+	}}
+
+	out, err := m.ToCSV()
+	if err != nil {
+		t.Fatalf("failed to convert to CSV: %s", err)
+	}
+	expected := "direction,protocol,port,nodeRole,serviceName,required,nodeName,schemaVersion\ningress,TCP,6443,master,kubernetes,true,,1\n"
+	if string(out) != expected {
+		t.Fatalf("got:\n%s\nexpected:\n%s", out, expected)
+	}
+
+	out, err = m.ToCSVWithColumns([]string{ColumnPort, ColumnProtocol})
+	if err != nil || string(out) != "port,protocol\n6443,TCP\n" {
+		t.Fatalf("got %q (err: %v), expected the port and protocol columns", out, err)
+	}
+
+	if _, err := m.ToCSVWithColumns([]string{"color"}); err == nil {
+		t.Fatalf("expected error for unknown column")
+	}
+
+	res, err := FromCSV([]byte("ingress,TCP,6443,master,kubernetes,true\n"))
+	if err != nil || len(res.Matrix) != 1 || res.Matrix[0] != m.Matrix[0] {
+		t.Fatalf("got %v (err: %v), expected the headerless CSV to be parsed", res.Matrix, err)
+	}
+}
+
+func TestFromCSVInvalid(t *testing.T) {
+	tests := []struct {
+		desc string
+		data string
+	}{
+		{desc: "missing fields", data: "ingress,TCP,6443\n"},
+		{desc: "invalid required field", data: "ingress,TCP,6443,master,kubernetes,maybe\n"},
+		{desc: "unknown column", data: "port,color\n6443,blue\n"},
+		{desc: "newer schema version", data: "port,schemaVersion\n6443,2\n"},
+	}
+
+	for _, test := range tests {
+		if _, err := FromCSV([]byte(test.data)); err == nil {
+			t.Fatalf("test \"%s\" failed: expected error", test.desc)
+		}
+	}
+}
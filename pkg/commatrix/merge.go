@@ -0,0 +1,142 @@
+package commatrix
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Source is a named matrix to merge, e.g. the matrix created from EndpointSlices or collected from the nodes.
+type Source struct {
+	Name   string
+	Matrix ComMatrix
+}
+
+// Conflict is a field that differs between the ComDetails of the same node role, node name, protocol and port.
+type Conflict struct {
+	NodeRole string `json:"nodeRole"`
+	// NodeName is the node of the ComDetails found on a specific node, and is empty for the node role ComDetails.
+	NodeName string `json:"nodeName,omitempty"`
+	Protocol string `json:"protocol"`
+	Port     string `json:"port"`
+	// Field is the JSON name of the differing field: direction, serviceName or required.
+	Field string `json:"field"`
+	// Values are the distinct values of the field, with the first source defining each of them,
+	// in precedence order. The first value is the merged one.
+	Values []SourceValue `json:"values"`
+}
+
+type SourceValue struct {
+	Source string `json:"source"`
+	Value  string `json:"value"`
+}
+
+// MergeResult is the merged matrix and the conflicts found while merging.
+type MergeResult struct {
+	Matrix    ComMatrix  `json:"matrix"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+func (c Conflict) String() string {
+	values := ""
+	for i, v := range c.Values {
+		if i > 0 {
+			values += ", "
+		}
+		values += fmt.Sprintf("%q from %s", v.Value, v.Source)
+	}
+
+	role := c.NodeRole
+	if c.NodeName != "" {
+		role += "/" + c.NodeName
+	}
+
+	return fmt.Sprintf("%s %s/%s: %s differs: %s", role, c.Protocol, c.Port, c.Field, values)
+}
+
+// Merge merges the sources, given in decreasing precedence, into a single matrix. For ComDetails of the
+// same node role, node name, protocol and port, the ComDetails of the source with the highest precedence is kept,
+// and every field that differs between the sources is recorded as a conflict. The metadata of the
+// merged matrix is the metadata of the first source that has metadata.
+func Merge(sources ...Source) MergeResult {
+	var (
+		merged    = ComMatrix{Matrix: make([]ComDetails, 0)}
+		conflicts = make(map[string]*Conflict)
+		keys      = make([]string, 0)
+		kept      = make(map[string]bool)
+	)
+	for _, source := range sources {
+		if merged.Metadata == nil {
+			merged.Metadata = source.Matrix.Metadata
+		}
+
+		for _, cd := range source.Matrix.Matrix {
+			// ComDetails found on a specific node do not override the ComDetails of its role.
+			key := reconcileKey(cd) + "-" + cd.NodeName
+			if !kept[key] {
+				kept[key] = true
+				merged.Matrix = append(merged.Matrix, cd)
+			}
+
+			for _, field := range mergedFields(cd) {
+				conflictKey := key + "/" + field.name
+				c, ok := conflicts[conflictKey]
+				if !ok {
+					c = &Conflict{NodeRole: cd.NodeRole, NodeName: cd.NodeName, Protocol: cd.Protocol, Port: cd.Port, Field: field.name}
+					conflicts[conflictKey] = c
+					keys = append(keys, conflictKey)
+				}
+				if !c.hasValue(field.value) {
+					c.Values = append(c.Values, SourceValue{Source: source.Name, Value: field.value})
+				}
+			}
+		}
+	}
+
+	res := MergeResult{Matrix: merged, Conflicts: make([]Conflict, 0)}
+	for _, key := range keys {
+		if c := conflicts[key]; len(c.Values) > 1 {
+			res.Conflicts = append(res.Conflicts, *c)
+		}
+	}
+
+	sort.SliceStable(res.Conflicts, func(i, j int) bool {
+		a, b := res.Conflicts[i], res.Conflicts[j]
+		if a.NodeRole != b.NodeRole {
+			return a.NodeRole < b.NodeRole
+		}
+		if a.NodeName != b.NodeName {
+			return a.NodeName < b.NodeName
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return comparePorts(a.Port, b.Port) < 0
+	})
+
+	return res
+}
+
+type mergedField struct {
+	name  string
+	value string
+}
+
+// mergedFields returns the fields of the ComDetails that are compared when merging.
+func mergedFields(cd ComDetails) []mergedField {
+	return []mergedField{
+		{name: ColumnDirection, value: cd.Direction},
+		{name: ColumnServiceName, value: cd.ServiceName},
+		{name: ColumnRequired, value: strconv.FormatBool(cd.Required)},
+	}
+}
+
+func (c *Conflict) hasValue(value string) bool {
+	for _, v := range c.Values {
+		if v.Value == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package commatrix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	var (
+		endpointSlices = Source{Name: "endpointslices", Matrix: ComMatrix{
+			Metadata: &Metadata{ClusterID: "cluster"},
+			Matrix: []ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+				{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", ServiceName: "node-exporter", Required: false},
+			},
+		}}
+		ss = Source{Name: "ss", Matrix: ComMatrix{Matrix: []ComDetails{
+			{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kube-apiserver", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", ServiceName: "node-exporter", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "worker", ServiceName: "sshd", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", NodeName: "worker-0", ServiceName: "node_exporter", Required: true},
+		}}}
+		additions = Source{Name: "additions", Matrix: ComMatrix{Matrix: []ComDetails{
+			{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "apiserver", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "worker", ServiceName: "sshd", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", NodeName: "worker-0", ServiceName: "exporter", Required: true},
+		}}}
+	)
+
+	res := Merge(endpointSlices, ss, additions)
+
+	expectedMatrix := []ComDetails{
+		endpointSlices.Matrix.Matrix[0],
+		endpointSlices.Matrix.Matrix[1],
+		ss.Matrix.Matrix[2],
+		ss.Matrix.Matrix[3],
+	}
+	if !reflect.DeepEqual(res.Matrix.Matrix, expectedMatrix) {
+		t.Fatalf("got matrix %v, expected %v", res.Matrix.Matrix, expectedMatrix)
+	}
+	if res.Matrix.Metadata != endpointSlices.Matrix.Metadata {
+		t.Fatalf("got metadata %v, expected the metadata of the first source", res.Matrix.Metadata)
+	}
+
+	expectedConflicts := []Conflict{
+		{NodeRole: "master", Protocol: "TCP", Port: "6443", Field: ColumnServiceName, Values: []SourceValue{
+			{Source: "endpointslices", Value: "kubernetes"},
+			{Source: "ss", Value: "kube-apiserver"},
+			{Source: "additions", Value: "apiserver"},
+		}},
+		{NodeRole: "worker", Protocol: "TCP", Port: "9100", Field: ColumnRequired, Values: []SourceValue{
+			{Source: "endpointslices", Value: "false"},
+			{Source: "ss", Value: "true"},
+		}},
+		{NodeRole: "worker", NodeName: "worker-0", Protocol: "TCP", Port: "9100", Field: ColumnServiceName, Values: []SourceValue{
+			{Source: "ss", Value: "node_exporter"},
+			{Source: "additions", Value: "exporter"},
+		}},
+	}
+	if !reflect.DeepEqual(res.Conflicts, expectedConflicts) {
+		t.Fatalf("got conflicts %+v, expected %+v", res.Conflicts, expectedConflicts)
+	}
+}
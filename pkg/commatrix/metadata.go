@@ -0,0 +1,103 @@
+package commatrix
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+)
+
+const modulePath = "github.com/liornoy/node-comm-lib"
+
+// Version is the version of the generator, set at build time with
+// -ldflags "-X github.com/liornoy/node-comm-lib/pkg/commatrix.Version=<version>".
+// When it is not set, the module version from the build information is used.
+var Version string
+
+// Metadata describes the cluster and the generator that produced a matrix.
+type Metadata struct {
+	// ClusterID is the UID of the kube-system namespace.
+	ClusterID string `json:"clusterID,omitempty"`
+	// ServerVersion is the Kubernetes version of the API server.
+	ServerVersion string `json:"serverVersion,omitempty"`
+	// NodesPerRole is the number of nodes of every node role.
+	NodesPerRole map[string]int `json:"nodesPerRole,omitempty"`
+	// GeneratorVersion is the version of the library that generated the matrix.
+	GeneratorVersion string `json:"generatorVersion,omitempty"`
+	// GeneratedAt is the time the matrix was generated, so matrices generated from the same cluster
+	// differ by it. Clear it with WithoutGenerationTime to compare or publish reproducible output.
+	GeneratedAt *time.Time `json:"generatedAt,omitempty"`
+	// Query lists the filters of the EndpointSlices query the matrix was created from.
+	Query []string `json:"query,omitempty"`
+}
+
+// NewMetadata returns the metadata of a matrix generated now from the cluster with the given nodes.
+func NewMetadata(cs *client.ClientSet, nodes *corev1.NodeList) (*Metadata, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	res := &Metadata{
+		NodesPerRole:     make(map[string]int),
+		GeneratorVersion: GeneratorVersion(),
+		GeneratedAt:      &now,
+	}
+
+	for _, role := range GetNodesRoles(nodes) {
+		res.NodesPerRole[role]++
+	}
+
+	ns, err := cs.Namespaces().Get(context.TODO(), metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get the %s namespace: %w", metav1.NamespaceSystem, err)
+	}
+	if err == nil {
+		res.ClusterID = string(ns.UID)
+	}
+
+	if cs.Discovery != nil {
+		version, err := cs.Discovery.ServerVersion()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the server version: %w", err)
+		}
+		res.ServerVersion = version.GitVersion
+	}
+
+	return res, nil
+}
+
+// WithoutGenerationTime returns the matrix with the generation time cleared from a copy of its metadata.
+func (m ComMatrix) WithoutGenerationTime() ComMatrix {
+	if m.Metadata != nil {
+		metadata := *m.Metadata
+		metadata.GeneratedAt = nil
+		m.Metadata = &metadata
+	}
+
+	return m
+}
+
+// GeneratorVersion returns the version of the library.
+func GeneratorVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+
+	return "devel"
+}
@@ -0,0 +1,101 @@
+package commatrix
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+)
+
+func TestNewMetadata(t *testing.T) {
+	fakeCS := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "8f2a6c1e"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "master-0", Labels: map[string]string{consts.MasterRole: ""}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Labels: map[string]string{consts.WorkerRole: ""}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Labels: map[string]string{consts.WorkerRole: ""}}},
+	)
+	discovery := fakeCS.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.28.1"}
+	cs := &client.ClientSet{CoreV1Interface: fakeCS.CoreV1(), Discovery: discovery}
+
+	nodes, err := cs.Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list nodes: %s", err)
+	}
+
+	metadata, err := NewMetadata(cs, nodes)
+	if err != nil {
+		t.Fatalf("failed to create metadata: %s", err)
+	}
+
+	if metadata.ClusterID != "8f2a6c1e" || metadata.ServerVersion != "v1.28.1" {
+		t.Fatalf("got cluster %q version %q, expected 8f2a6c1e and v1.28.1", metadata.ClusterID, metadata.ServerVersion)
+	}
+	if metadata.NodesPerRole["master"] != 1 || metadata.NodesPerRole["worker"] != 2 {
+		t.Fatalf("got nodes per role %v, expected 1 master and 2 workers", metadata.NodesPerRole)
+	}
+	if metadata.GeneratorVersion == "" || metadata.GeneratedAt == nil {
+		t.Fatalf("expected the generator version and time to be set, got %+v", metadata)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	m := ComMatrix{
+		Metadata: &Metadata{ClusterID: "8f2a6c1e", NodesPerRole: map[string]int{"worker": 2}, Query: []string{"hostNetwork"}},
+		Matrix:   []ComDetails{{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true}},
+	}
+
+	out, err := m.ToYAML()
+	if err != nil {
+		t.Fatalf("failed to convert to YAML: %s", err)
+	}
+
+	res, err := FromYAML(out)
+	if err != nil {
+		t.Fatalf("failed to load YAML: %s", err)
+	}
+
+	if res.Metadata == nil || res.Metadata.ClusterID != "8f2a6c1e" || res.Metadata.NodesPerRole["worker"] != 2 || res.Metadata.Query[0] != "hostNetwork" {
+		t.Fatalf("got metadata %+v, expected it to be preserved", res.Metadata)
+	}
+	if len(res.Matrix) != 1 || res.Matrix[0] != m.Matrix[0] {
+		t.Fatalf("got matrix %v, expected %v", res.Matrix, m.Matrix)
+	}
+}
+
+func TestMetadataPreserved(t *testing.T) {
+	now := time.Now()
+	m := ComMatrix{
+		Metadata: &Metadata{ClusterID: "8f2a6c1e", GeneratedAt: &now},
+		Matrix:   []ComDetails{{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true}},
+	}
+
+	sorted, err := m.Sorted()
+	if err != nil {
+		t.Fatalf("failed to sort: %s", err)
+	}
+
+	for desc, res := range map[string]ComMatrix{"sorted": sorted, "diff": m.Diff(ComMatrix{}, nil)} {
+		if res.Metadata != m.Metadata || len(res.Matrix) != 1 {
+			t.Fatalf("test \"%s\" failed: got %+v, expected the metadata and the ComDetails to be kept", desc, res)
+		}
+	}
+
+	res := m.WithoutGenerationTime()
+	if res.Metadata.GeneratedAt != nil || res.Metadata.ClusterID != "8f2a6c1e" || m.Metadata.GeneratedAt == nil {
+		t.Fatalf("expected the generation time to be cleared from a copy, got %+v and %+v", res.Metadata, m.Metadata)
+	}
+
+	out, err := ComMatrix{}.ToJSON()
+	if err != nil || string(out) != `{"matrix":[]}` {
+		t.Fatalf("got %s (err: %v), expected an object without metadata", out, err)
+	}
+}
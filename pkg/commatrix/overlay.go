@@ -0,0 +1,221 @@
+package commatrix
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// OverlayVersion is the version of the overlay format written and accepted by this package.
+const OverlayVersion = 1
+
+var (
+	overlayProtocols = map[string]bool{"TCP": true, "UDP": true, "SCTP": true}
+	// overlayPortlessProtocols are the IP protocols without ports, whose entries have an empty port,
+	// e.g. VRRP between keepalived instances.
+	overlayPortlessProtocols = map[string]bool{"ICMP": true, "ICMPv6": true, "VRRP": true, "GRE": true, "ESP": true, "AH": true}
+	overlayDirections        = map[string]bool{"ingress": true, "egress": true}
+)
+
+// Overlay holds manual changes to a matrix, for ports that neither the EndpointSlices nor
+// the nodes sockets reveal. Removals are applied first, then overrides, then additions.
+type Overlay struct {
+	Version   int               `json:"version"`
+	Additions []ComDetails      `json:"additions,omitempty"`
+	Removals  []OverlayMatch    `json:"removals,omitempty"`
+	Overrides []OverlayOverride `json:"overrides,omitempty"`
+}
+
+// OverlayMatch selects ComDetails. Empty fields match any value, but at least one field must be set.
+type OverlayMatch struct {
+	Protocol    string `json:"protocol,omitempty"`
+	Port        string `json:"port,omitempty"`
+	NodeRole    string `json:"nodeRole,omitempty"`
+	ServiceName string `json:"serviceName,omitempty"`
+	// NodeName matches the ComDetails found on, or added for, a specific node.
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+// OverlayOverride sets the fields of the ComDetails it matches.
+type OverlayOverride struct {
+	Match OverlayMatch `json:"match"`
+	Set   OverlaySet   `json:"set"`
+}
+
+// OverlaySet holds the fields set by an override. Nil fields are left unchanged.
+type OverlaySet struct {
+	Direction   *string `json:"direction,omitempty"`
+	ServiceName *string `json:"serviceName,omitempty"`
+	Required    *bool   `json:"required,omitempty"`
+}
+
+// LoadOverlayFile reads an Overlay from a YAML or JSON file, rejecting unknown fields.
+func LoadOverlayFile(path string) (Overlay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Overlay{}, fmt.Errorf("failed to read overlay file: %w", err)
+	}
+
+	var o Overlay
+	err = yaml.UnmarshalStrict(data, &o)
+	if err != nil {
+		return Overlay{}, fmt.Errorf("failed to parse overlay file: %w", err)
+	}
+
+	return o, o.Validate()
+}
+
+// Validate checks the overlay version and its entries. Additions need a node role and a TCP, UDP or SCTP
+// port, or no port for the protocols without ports such as VRRP. Additions with a node name apply to that
+// node only, next to the entries of its node role. Matches need at least one field.
+func (o Overlay) Validate() error {
+	if o.Version != OverlayVersion {
+		return fmt.Errorf("unsupported overlay version %d, expected %d", o.Version, OverlayVersion)
+	}
+
+	for i, cd := range o.Additions {
+		if err := validateOverlayAddition(cd); err != nil {
+			return fmt.Errorf("addition %d: %w", i, err)
+		}
+	}
+
+	for i, m := range o.Removals {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("removal %d: %w", i, err)
+		}
+	}
+
+	for i, override := range o.Overrides {
+		if err := override.Match.validate(); err != nil {
+			return fmt.Errorf("override %d: %w", i, err)
+		}
+		set := override.Set
+		if set.Direction == nil && set.ServiceName == nil && set.Required == nil {
+			return fmt.Errorf("override %d: no field to set", i)
+		}
+		if set.Direction != nil && !overlayDirections[*set.Direction] {
+			return fmt.Errorf("override %d: invalid direction %q", i, *set.Direction)
+		}
+	}
+
+	return nil
+}
+
+// Apply returns a copy of the matrix with the overlay applied. An addition of a port that the matrix
+// already has for the same node role, node name and protocol is ignored, overrides change existing entries.
+func (o Overlay) Apply(m ComMatrix) ComMatrix {
+	res := ComMatrix{Metadata: m.Metadata, Matrix: make([]ComDetails, 0, len(m.Matrix)+len(o.Additions))}
+	for _, cd := range m.Matrix {
+		if o.removes(cd) {
+			continue
+		}
+		for _, override := range o.Overrides {
+			if override.Match.matches(cd) {
+				cd = override.Set.apply(cd)
+			}
+		}
+		res.Matrix = append(res.Matrix, cd)
+	}
+
+	for _, cd := range o.Additions {
+		if cd.Direction == "" {
+			cd.Direction = "ingress"
+		}
+		res.Matrix = append(res.Matrix, cd)
+	}
+
+	// Unlike RemoveDups, the entries of a node are kept next to the entries of its node role.
+	var (
+		cds  = make([]ComDetails, 0, len(res.Matrix))
+		seen = make(map[string]bool)
+	)
+	for _, cd := range res.Matrix {
+		key := reconcileKey(cd) + "-" + cd.NodeName
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		cds = append(cds, cd)
+	}
+	res.Matrix = cds
+
+	return res
+}
+
+func (o Overlay) removes(cd ComDetails) bool {
+	for _, m := range o.Removals {
+		if m.matches(cd) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m OverlayMatch) matches(cd ComDetails) bool {
+	return (m.Protocol == "" || m.Protocol == cd.Protocol) &&
+		(m.Port == "" || m.Port == cd.Port) &&
+		(m.NodeRole == "" || m.NodeRole == cd.NodeRole) &&
+		(m.ServiceName == "" || m.ServiceName == cd.ServiceName) &&
+		(m.NodeName == "" || m.NodeName == cd.NodeName)
+}
+
+func (m OverlayMatch) validate() error {
+	if m == (OverlayMatch{}) {
+		return fmt.Errorf("empty match")
+	}
+	if m.Protocol != "" && !overlayProtocols[m.Protocol] && !overlayPortlessProtocols[m.Protocol] {
+		return fmt.Errorf("invalid protocol %q", m.Protocol)
+	}
+	if m.Port != "" {
+		return validateOverlayPort(m.Port)
+	}
+
+	return nil
+}
+
+func (s OverlaySet) apply(cd ComDetails) ComDetails {
+	if s.Direction != nil {
+		cd.Direction = *s.Direction
+	}
+	if s.ServiceName != nil {
+		cd.ServiceName = *s.ServiceName
+	}
+	if s.Required != nil {
+		cd.Required = *s.Required
+	}
+
+	return cd
+}
+
+func validateOverlayAddition(cd ComDetails) error {
+	if !overlayProtocols[cd.Protocol] && !overlayPortlessProtocols[cd.Protocol] {
+		return fmt.Errorf("invalid protocol %q", cd.Protocol)
+	}
+	if cd.NodeRole == "" {
+		return fmt.Errorf("missing node role")
+	}
+	if cd.Direction != "" && !overlayDirections[cd.Direction] {
+		return fmt.Errorf("invalid direction %q", cd.Direction)
+	}
+
+	if overlayPortlessProtocols[cd.Protocol] {
+		if cd.Port != "" {
+			return fmt.Errorf("protocol %s has no ports, got port %q", cd.Protocol, cd.Port)
+		}
+		return nil
+	}
+
+	return validateOverlayPort(cd.Port)
+}
+
+func validateOverlayPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package commatrix
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/pointer"
+)
+
+func TestOverlayApply(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kube-apiserver", Required: false},
+		{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", ServiceName: "node-exporter", Required: false},
+		{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "master", ServiceName: "node-exporter", Required: false},
+		{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+	}}
+
+	o, err := LoadOverlayFile("testdata/overlay.yaml")
+	if err != nil {
+		t.Fatalf("failed to load overlay: %s", err)
+	}
+
+	expected := []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "master", ServiceName: "node-exporter", Required: false},
+		{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "179", NodeRole: "worker", ServiceName: "bgp", Required: true},
+		{Direction: "ingress", Protocol: "VRRP", NodeRole: "master", ServiceName: "keepalived", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", NodeName: "worker-0", ServiceName: "kubelet-debug", Required: false},
+	}
+
+	res := o.Apply(m)
+	if !reflect.DeepEqual(res.Matrix, expected) {
+		t.Fatalf("got matrix %v, expected %v", res.Matrix, expected)
+	}
+	if m.Matrix[0].ServiceName != "kube-apiserver" {
+		t.Fatalf("expected the original matrix to be unchanged, got %v", m.Matrix[0])
+	}
+}
+
+func TestOverlayValidate(t *testing.T) {
+	tests := []struct {
+		desc        string
+		overlay     Overlay
+		expectedErr string
+	}{
+		{
+			desc:    "valid",
+			overlay: Overlay{Version: 1, Removals: []OverlayMatch{{Protocol: "UDP"}}},
+		},
+		{
+			desc:        "unsupported version",
+			overlay:     Overlay{Version: 2},
+			expectedErr: "unsupported overlay version 2",
+		},
+		{
+			desc:        "invalid addition port",
+			overlay:     Overlay{Version: 1, Additions: []ComDetails{{Protocol: "TCP", Port: "70000", NodeRole: "worker"}}},
+			expectedErr: "addition 0: invalid port \"70000\"",
+		},
+		{
+			desc:    "port-less addition",
+			overlay: Overlay{Version: 1, Additions: []ComDetails{{Protocol: "VRRP", NodeRole: "master", NodeName: "master-0"}}},
+		},
+		{
+			desc:        "port-less addition with port",
+			overlay:     Overlay{Version: 1, Additions: []ComDetails{{Protocol: "VRRP", Port: "112", NodeRole: "master"}}},
+			expectedErr: "addition 0: protocol VRRP has no ports",
+		},
+		{
+			desc:        "addition without port",
+			overlay:     Overlay{Version: 1, Additions: []ComDetails{{Protocol: "TCP", NodeRole: "worker"}}},
+			expectedErr: "addition 0: invalid port \"\"",
+		},
+		{
+			desc:        "addition without role",
+			overlay:     Overlay{Version: 1, Additions: []ComDetails{{Protocol: "TCP", Port: "179"}}},
+			expectedErr: "addition 0: missing node role",
+		},
+		{
+			desc:        "empty removal",
+			overlay:     Overlay{Version: 1, Removals: []OverlayMatch{{}}},
+			expectedErr: "removal 0: empty match",
+		},
+		{
+			desc:        "override without fields",
+			overlay:     Overlay{Version: 1, Overrides: []OverlayOverride{{Match: OverlayMatch{Port: "22"}}}},
+			expectedErr: "override 0: no field to set",
+		},
+		{
+			desc: "override with invalid direction",
+			overlay: Overlay{Version: 1, Overrides: []OverlayOverride{{
+				Match: OverlayMatch{Port: "22"},
+				Set:   OverlaySet{Direction: pointer.StrPtr("inbound")},
+			}}},
+			expectedErr: "override 0: invalid direction \"inbound\"",
+		},
+	}
+
+	for _, test := range tests {
+		err := test.overlay.Validate()
+		if test.expectedErr == "" && err != nil {
+			t.Fatalf("test \"%s\" failed: unexpected error: %s", test.desc, err)
+		}
+		if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+			t.Fatalf("test \"%s\" failed: got error %v, expected %q", test.desc, err, test.expectedErr)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package commatrix
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+type ReconcileStatus string
+
+const (
+	// DocumentedListening is a documented port that a node is listening to.
+	DocumentedListening ReconcileStatus = "documented-listening"
+	// DocumentedNotListening is a documented port that no node of the role is listening to.
+	DocumentedNotListening ReconcileStatus = "documented-not-listening"
+	// UndocumentedListening is a port that a node is listening to without being documented.
+	UndocumentedListening ReconcileStatus = "undocumented-listening"
+)
+
+// ReconcileEntry classifies a single port of a node role.
+type ReconcileEntry struct {
+	Status   ReconcileStatus `json:"status"`
+	NodeRole string          `json:"nodeRole"`
+	Protocol string          `json:"protocol"`
+	Port     string          `json:"port"`
+	// ServiceName is the service or pod documenting the port.
+	ServiceName string `json:"serviceName,omitempty"`
+	// Process is the process found listening to the port.
+	Process  string `json:"process,omitempty"`
+	Required bool   `json:"required"`
+}
+
+type ReconcileReport struct {
+	Entries []ReconcileEntry `json:"entries"`
+}
+
+var reconcileHeader = []string{"STATUS", "NODE ROLE", "PROTOCOL", "PORT", "SERVICE", "PROCESS", "REQUIRED"}
+
+// Reconcile classifies every port of the documented matrix (e.g. created from EndpointSlices) and the
+// listening matrix (e.g. created from the nodes sockets) per node role.
+func Reconcile(documented ComMatrix, listening ComMatrix) ReconcileReport {
+	listeningByKey := make(map[string]ComDetails)
+	for _, cd := range listening.Matrix {
+		key := reconcileKey(cd)
+		if _, ok := listeningByKey[key]; !ok {
+			listeningByKey[key] = cd
+		}
+	}
+
+	entries := make([]ReconcileEntry, 0)
+	documentedKeys := make(map[string]bool)
+	for _, cd := range documented.Matrix {
+		key := reconcileKey(cd)
+		if documentedKeys[key] {
+			continue
+		}
+		documentedKeys[key] = true
+
+		entry := ReconcileEntry{
+			Status:      DocumentedNotListening,
+			NodeRole:    cd.NodeRole,
+			Protocol:    cd.Protocol,
+			Port:        cd.Port,
+			ServiceName: cd.ServiceName,
+			Required:    cd.Required,
+		}
+		if l, ok := listeningByKey[key]; ok {
+			entry.Status = DocumentedListening
+			entry.Process = l.ServiceName
+		}
+		entries = append(entries, entry)
+	}
+
+	for key, cd := range listeningByKey {
+		if documentedKeys[key] {
+			continue
+		}
+		entries = append(entries, ReconcileEntry{
+			Status:   UndocumentedListening,
+			NodeRole: cd.NodeRole,
+			Protocol: cd.Protocol,
+			Port:     cd.Port,
+			Process:  cd.ServiceName,
+			Required: cd.Required,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.NodeRole != b.NodeRole {
+			return a.NodeRole < b.NodeRole
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return comparePorts(a.Port, b.Port) < 0
+	})
+
+	return ReconcileReport{Entries: entries}
+}
+
+// Filter returns the entries with the given status.
+func (r ReconcileReport) Filter(status ReconcileStatus) []ReconcileEntry {
+	res := make([]ReconcileEntry, 0)
+	for _, e := range r.Entries {
+		if e.Status == status {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+func (r ReconcileReport) ToJSON() ([]byte, error) {
+	out, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (r ReconcileReport) ToCSV() ([]byte, error) {
+	w := bytes.NewBuffer(make([]byte, 0))
+	csvwriter := csv.NewWriter(w)
+
+	records := [][]string{reconcileHeader}
+	for _, e := range r.Entries {
+		records = append(records, e.record())
+	}
+
+	err := csvwriter.WriteAll(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to CSV format: %w", err)
+	}
+
+	return w.Bytes(), nil
+}
+
+// ToTable returns the report as a human readable table.
+func (r ReconcileReport) ToTable() ([]byte, error) {
+	w := bytes.NewBuffer(make([]byte, 0))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	records := [][]string{reconcileHeader}
+	for _, e := range r.Entries {
+		records = append(records, e.record())
+	}
+
+	for _, record := range records {
+		for i, field := range record {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, field)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to table format: %w", err)
+	}
+
+	return w.Bytes(), nil
+}
+
+func (e ReconcileEntry) record() []string {
+	return []string{string(e.Status), e.NodeRole, e.Protocol, e.Port, e.ServiceName, e.Process, strconv.FormatBool(e.Required)}
+}
+
+func reconcileKey(cd ComDetails) string {
+	return fmt.Sprintf("%s-%s-%s", cd.NodeRole, cd.Port, cd.Protocol)
+}
+
+// comparePorts compares ports numerically, falling back to a string comparison for non numeric ports.
+func comparePorts(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return na - nb
+	}
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,53 @@
+package commatrix
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	var (
+		documented = ComMatrix{Matrix: []ComDetails{
+			{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", ServiceName: "node-exporter", Required: false},
+		}}
+		listening = ComMatrix{Matrix: []ComDetails{
+			{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kube-apiserver", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+			{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "worker", ServiceName: "sshd", Required: false},
+			{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "worker", ServiceName: "haproxy", Required: true},
+		}}
+		expected = []ReconcileEntry{
+			{Status: DocumentedListening, NodeRole: "master", Protocol: "TCP", Port: "6443", ServiceName: "kubernetes", Process: "kube-apiserver", Required: true},
+			{Status: UndocumentedListening, NodeRole: "worker", Protocol: "TCP", Port: "22", Process: "sshd", Required: false},
+			{Status: UndocumentedListening, NodeRole: "worker", Protocol: "TCP", Port: "6443", Process: "haproxy", Required: true},
+			{Status: DocumentedNotListening, NodeRole: "worker", Protocol: "TCP", Port: "9100", ServiceName: "node-exporter", Required: false},
+			{Status: DocumentedListening, NodeRole: "worker", Protocol: "TCP", Port: "10250", ServiceName: "kubelet", Process: "kubelet", Required: true},
+		}
+	)
+
+	report := Reconcile(documented, listening)
+	if len(report.Entries) != len(expected) {
+		t.Fatalf("got %d entries, expected %d: %v", len(report.Entries), len(expected), report.Entries)
+	}
+
+	for i := range expected {
+		if report.Entries[i] != expected[i] {
+			t.Fatalf("entry %d: got %+v, expected %+v", i, report.Entries[i], expected[i])
+		}
+	}
+
+	if n := len(report.Filter(UndocumentedListening)); n != 2 {
+		t.Fatalf("got %d undocumented entries, expected 2", n)
+	}
+
+	out, err := report.ToCSV()
+	if err != nil {
+		t.Fatalf("failed to convert report to CSV: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != len(expected)+1 || !strings.HasPrefix(lines[0], "STATUS,") {
+		t.Fatalf("got unexpected CSV output:\n%s", out)
+	}
+}
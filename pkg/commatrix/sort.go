@@ -0,0 +1,113 @@
+package commatrix
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SortKey is a ComDetails field the matrix can be sorted by.
+type SortKey string
+
+const (
+	SortByNodeRole    SortKey = "nodeRole"
+	SortByProtocol    SortKey = "protocol"
+	SortByPort        SortKey = "port"
+	SortByServiceName SortKey = "serviceName"
+	SortByNodeName    SortKey = "nodeName"
+)
+
+// DefaultSortOrder is the sort order of WriteTo.
+var DefaultSortOrder = []SortKey{SortByNodeRole, SortByProtocol, SortByPort, SortByServiceName}
+
+// Sorted returns a sorted copy of the matrix. ComDetails that are equal by the keys are ordered by
+// all of their fields, so the order is total and does not depend on the order of the matrix.
+func (m ComMatrix) Sorted(keys ...SortKey) (ComMatrix, error) {
+	for _, key := range keys {
+		if _, ok := compareBy(key, ComDetails{}, ComDetails{}); !ok {
+			return ComMatrix{}, fmt.Errorf("unsupported sort key %q", key)
+		}
+	}
+
+	keys = append(append([]SortKey{}, keys...), SortByNodeRole, SortByProtocol, SortByPort, SortByServiceName, SortByNodeName)
+	sorted := append([]ComDetails{}, m.Matrix...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, key := range keys {
+			if c, _ := compareBy(key, sorted[i], sorted[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return compareFields(sorted[i], sorted[j]) < 0
+	})
+
+	return ComMatrix{Metadata: m.Metadata, Matrix: sorted}, nil
+}
+
+// WriteTo writes the matrix sorted by the DefaultSortOrder to w, a ComDetails per line.
+// The matrix is not modified.
+func (m ComMatrix) WriteTo(w io.Writer) (int64, error) {
+	return m.WriteSorted(w, DefaultSortOrder...)
+}
+
+// WriteSorted writes the matrix sorted by the keys to w, a ComDetails per line. The matrix is not modified.
+// When a ComDetails has its NodeName set, every line has a node column following the node role.
+func (m ComMatrix) WriteSorted(w io.Writer, keys ...SortKey) (int64, error) {
+	sorted, err := m.Sorted(keys...)
+	if err != nil {
+		return 0, err
+	}
+
+	withNodes := false
+	for _, cd := range sorted.Matrix {
+		withNodes = withNodes || cd.NodeName != ""
+	}
+
+	var written int64
+	for _, cd := range sorted.Matrix {
+		line := cd.String()
+		if withNodes {
+			line = strings.Join(cd.record(), ",")
+		}
+		n, err := fmt.Fprintln(w, line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// compareBy compares the ComDetails by the key, and returns false for unsupported keys.
+func compareBy(key SortKey, a, b ComDetails) (int, bool) {
+	switch key {
+	case SortByNodeRole:
+		return strings.Compare(a.NodeRole, b.NodeRole), true
+	case SortByProtocol:
+		return strings.Compare(a.Protocol, b.Protocol), true
+	case SortByPort:
+		return comparePorts(a.Port, b.Port), true
+	case SortByServiceName:
+		return strings.Compare(a.ServiceName, b.ServiceName), true
+	case SortByNodeName:
+		return strings.Compare(a.NodeName, b.NodeName), true
+	}
+
+	return 0, false
+}
+
+// compareFields compares the fields of the ComDetails that are not sort keys.
+func compareFields(a, b ComDetails) int {
+	if c := strings.Compare(a.Direction, b.Direction); c != 0 {
+		return c
+	}
+	if a.Required != b.Required {
+		if a.Required {
+			return -1
+		}
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,83 @@
+package commatrix
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	cds := []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+		{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "master", ServiceName: "ovn", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "master", ServiceName: "node-exporter", Required: false},
+		{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "master", ServiceName: "kube-rbac-proxy", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "master", ServiceName: "sshd", Required: true},
+	}
+	original := append([]ComDetails{}, cds...)
+
+	expected := `ingress,TCP,22,master,sshd,true
+ingress,TCP,9100,master,kube-rbac-proxy,true
+ingress,TCP,9100,master,node-exporter,false
+ingress,UDP,6081,master,ovn,true
+ingress,TCP,10250,worker,kubelet,true
+`
+
+	var out bytes.Buffer
+	n, err := ComMatrix{Matrix: cds}.WriteTo(&out)
+	if err != nil {
+		t.Fatalf("failed to write matrix: %s", err)
+	}
+	if out.String() != expected || n != int64(len(expected)) {
+		t.Fatalf("got (%d bytes):\n%s\nexpected (%d bytes):\n%s", n, out.String(), len(expected), expected)
+	}
+
+	for i := range cds {
+		if cds[i] != original[i] {
+			t.Fatalf("WriteTo modified the matrix: got %v at %d, expected %v", cds[i], i, original[i])
+		}
+	}
+
+	reversed := make([]ComDetails, 0, len(cds))
+	for i := len(cds) - 1; i >= 0; i-- {
+		reversed = append(reversed, cds[i])
+	}
+	out.Reset()
+	if _, err := (ComMatrix{Matrix: reversed}).WriteTo(&out); err != nil || out.String() != expected {
+		t.Fatalf("got output depending on the matrix order:\n%s", out.String())
+	}
+}
+
+func TestWriteToNodeNames(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+		{Direction: "ingress", Protocol: "UDP", Port: "319", NodeRole: "worker", ServiceName: "ptp4l", Required: true, NodeName: "worker-0"},
+	}}
+
+	expected := `ingress,TCP,10250,worker,,kubelet,true
+ingress,UDP,319,worker,worker-0,ptp4l,true
+`
+
+	var out bytes.Buffer
+	if _, err := m.WriteTo(&out); err != nil || out.String() != expected {
+		t.Fatalf("got (err: %v):\n%s\nexpected:\n%s", err, out.String(), expected)
+	}
+}
+
+func TestSorted(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Protocol: "TCP", Port: "80", ServiceName: "b"},
+		{Protocol: "TCP", Port: "443", ServiceName: "a"},
+	}}
+
+	sorted, err := m.Sorted(SortByServiceName)
+	if err != nil {
+		t.Fatalf("failed to sort matrix: %s", err)
+	}
+	if sorted.Matrix[0].ServiceName != "a" {
+		t.Fatalf("got %v, expected the matrix to be sorted by service", sorted.Matrix)
+	}
+
+	if _, err := m.Sorted("color"); err == nil {
+		t.Fatalf("expected error for unsupported sort key")
+	}
+}
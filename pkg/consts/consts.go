@@ -1,6 +1,7 @@
 package consts
 
 const (
+	CollectorLabel       = "commatrix-collector"
 	DefaultAddressType   = "IPv4"
 	IngressLabel         = "ingress"
 	MasterRole           = "node-role.kubernetes.io/master"
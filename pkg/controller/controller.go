@@ -0,0 +1,386 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/liornoy/node-comm-lib/pkg/api/v1alpha1"
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/endpointslices"
+)
+
+const (
+	// OutputCommunicationMatrix writes the matrix to a CommunicationMatrix.
+	OutputCommunicationMatrix = "CommunicationMatrix"
+	// OutputConfigMap writes the matrix as JSON to the MatrixKey of a ConfigMap.
+	OutputConfigMap = "ConfigMap"
+
+	MatrixKey = "matrix.json"
+
+	// ConditionGenerated is the condition of a CommunicationMatrix whose entries were generated.
+	ConditionGenerated = "Generated"
+
+	// Event and condition reasons.
+	ReasonGenerated        = "Generated"
+	ReasonNewPort          = "NewPort"
+	ReasonRemovedPort      = "RemovedPort"
+	ReasonNoEndpointSlices = "NoEndpointSlices"
+)
+
+// errNoEndpointSlices is returned by generate when the cluster has no ingress EndpointSlices yet.
+var errNoEndpointSlices = errors.New("no ingress EndpointSlices")
+
+// Options of the Reconciler. The zero value writes the matrix to the "commatrix" CommunicationMatrix.
+type Options struct {
+	// Name of the written object, "commatrix" by default.
+	Name string
+	// Namespace of the ConfigMap, "commatrix" by default.
+	Namespace string
+	// Output is either OutputCommunicationMatrix (default) or OutputConfigMap.
+	Output string
+	// Overlays are applied to the generated matrix.
+	Overlays []commatrix.Overlay
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Name == "" {
+		o.Name = "commatrix"
+	}
+	if o.Namespace == "" {
+		o.Namespace = "commatrix"
+	}
+	if o.Output == "" {
+		o.Output = OutputCommunicationMatrix
+	}
+	if o.Output != OutputCommunicationMatrix && o.Output != OutputConfigMap {
+		return o, fmt.Errorf("invalid output %q", o.Output)
+	}
+
+	return o, nil
+}
+
+// Reconciler regenerates the matrix from the EndpointSlices of the cluster and writes it to a
+// CommunicationMatrix or a ConfigMap. It raises an Event for every port added or removed since
+// the previous generation.
+type Reconciler struct {
+	*client.ClientSet
+	Recorder record.EventRecorder
+	Options  Options
+}
+
+// +kubebuilder:rbac:groups=commatrix.io,resources=communicationmatrices;communicationmatrices/status,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=pods;services;nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+
+// Reconcile regenerates the matrix. All the requests are for the same matrix, so the request is ignored.
+func (r *Reconciler) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	opts, err := r.Options.withDefaults()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	m, err := r.generate()
+	if errors.Is(err, errNoEndpointSlices) {
+		// Creating an ingress EndpointSlice triggers the next reconcile, so there is nothing to retry.
+		// The previous matrix is kept rather than replaced with an empty one.
+		return reconcile.Result{}, r.markNotGenerated(ctx, opts)
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if opts.Output == OutputConfigMap {
+		return reconcile.Result{}, r.writeConfigMap(ctx, m, opts)
+	}
+
+	return reconcile.Result{}, r.writeCommunicationMatrix(ctx, m, opts)
+}
+
+// generate creates the matrix from the ingress EndpointSlices, like the generate command.
+func (r *Reconciler) generate() (commatrix.ComMatrix, error) {
+	q, err := endpointslices.NewQuery(r.Client)
+	if err != nil {
+		return commatrix.ComMatrix{}, fmt.Errorf("failed creating EndpointSlices query: %w", err)
+	}
+
+	ingressSlices := q.
+		WithHostNetwork().
+		WithLabels(map[string]string{consts.IngressLabel: ""}).
+		WithServiceType(corev1.ServiceTypeNodePort).
+		WithServiceType(corev1.ServiceTypeLoadBalancer).
+		Query()
+	if len(ingressSlices) == 0 {
+		return commatrix.ComMatrix{}, errNoEndpointSlices
+	}
+
+	m, err := commatrix.CreateComMatrix(r.ClientSet, ingressSlices, r.Options.Overlays...)
+	if err != nil {
+		return commatrix.ComMatrix{}, err
+	}
+	m.Metadata.Query = q.Params()
+
+	// The written entries are sorted, so they are compared regardless of the listing order.
+	return m.Sorted()
+}
+
+func (r *Reconciler) writeCommunicationMatrix(ctx context.Context, m commatrix.ComMatrix, opts Options) error {
+	entries, err := v1alpha1.EntriesFromComMatrix(m)
+	if err != nil {
+		return err
+	}
+
+	cm := &v1alpha1.CommunicationMatrix{}
+	err = r.Get(ctx, types.NamespacedName{Name: opts.Name}, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &v1alpha1.CommunicationMatrix{
+			ObjectMeta: metav1.ObjectMeta{Name: opts.Name},
+			Spec:       v1alpha1.CommunicationMatrixSpec{Entries: entries},
+		}
+		if err := r.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create CommunicationMatrix: %w", err)
+		}
+		r.Recorder.Eventf(cm, corev1.EventTypeNormal, ReasonGenerated, "Generated %d entries", len(entries))
+		return r.updateStatus(ctx, cm, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get CommunicationMatrix: %w", err)
+	}
+
+	previous := cm.ToComMatrix()
+	r.recordChanges(cm, previous, m)
+	if !equalEntries(cm.Spec.Entries, entries) {
+		cm.Spec.Entries = entries
+		if err := r.Update(ctx, cm); err != nil {
+			return fmt.Errorf("failed to update CommunicationMatrix: %w", err)
+		}
+	}
+
+	return r.updateStatus(ctx, cm, drift(previous, m))
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, cm *v1alpha1.CommunicationMatrix, drift int) error {
+	now := metav1.Now()
+	cm.Status.LastGenerated = &now
+	cm.Status.DriftCount = int32(drift)
+	cm.Status.ObservedGeneration = cm.Generation
+	meta.SetStatusCondition(&cm.Status.Conditions, metav1.Condition{
+		Type:               ConditionGenerated,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonGenerated,
+		Message:            fmt.Sprintf("%d entries", len(cm.Spec.Entries)),
+		ObservedGeneration: cm.Generation,
+	})
+
+	err := r.Status().Update(ctx, cm)
+	if err != nil {
+		return fmt.Errorf("failed to update CommunicationMatrix status: %w", err)
+	}
+
+	return nil
+}
+
+// markNotGenerated sets the Generated condition of the CommunicationMatrix to false, keeping its entries.
+// A ConfigMap has no status, so it is left unchanged.
+func (r *Reconciler) markNotGenerated(ctx context.Context, opts Options) error {
+	if opts.Output == OutputConfigMap {
+		return nil
+	}
+
+	cm := &v1alpha1.CommunicationMatrix{}
+	err := r.Get(ctx, types.NamespacedName{Name: opts.Name}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get CommunicationMatrix: %w", err)
+	}
+
+	meta.SetStatusCondition(&cm.Status.Conditions, metav1.Condition{
+		Type:               ConditionGenerated,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonNoEndpointSlices,
+		Message:            "The cluster has no ingress EndpointSlices",
+		ObservedGeneration: cm.Generation,
+	})
+
+	err = r.Status().Update(ctx, cm)
+	if err != nil {
+		return fmt.Errorf("failed to update CommunicationMatrix status: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Reconciler) writeConfigMap(ctx context.Context, m commatrix.ComMatrix, opts Options) error {
+	out, err := m.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to convert matrix to JSON: %w", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: opts.Namespace, Name: opts.Name}, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Namespace: opts.Namespace},
+			Data:       map[string]string{MatrixKey: string(out)},
+		}
+		if err := r.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create ConfigMap: %w", err)
+		}
+		r.Recorder.Eventf(cm, corev1.EventTypeNormal, ReasonGenerated, "Generated %d entries", len(m.Matrix))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get ConfigMap: %w", err)
+	}
+
+	// A ConfigMap without a valid matrix is overwritten without raising events. The metadata is not
+	// compared, as its generation time changes on every generation.
+	previous, err := commatrix.FromJSON([]byte(cm.Data[MatrixKey]))
+	if err == nil {
+		r.recordChanges(cm, previous, m)
+		if drift(previous, m) == 0 {
+			return nil
+		}
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[MatrixKey] = string(out)
+	if err := r.Update(ctx, cm); err != nil {
+		return fmt.Errorf("failed to update ConfigMap: %w", err)
+	}
+
+	return nil
+}
+
+// recordChanges raises an Event on the object for every port added or removed by the current matrix.
+func (r *Reconciler) recordChanges(obj runtimeclient.Object, previous commatrix.ComMatrix, current commatrix.ComMatrix) {
+	for _, e := range commatrix.Reconcile(previous, current).Entries {
+		switch e.Status {
+		case commatrix.UndocumentedListening:
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, ReasonNewPort, "New port %s %s/%s of service %q", e.NodeRole, e.Protocol, e.Port, e.Process)
+		case commatrix.DocumentedNotListening:
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, ReasonRemovedPort, "Removed port %s %s/%s of service %q", e.NodeRole, e.Protocol, e.Port, e.ServiceName)
+		}
+	}
+}
+
+// drift returns the number of entries added, removed or changed by the current matrix. The entries of the
+// same node role, node name, protocol and port are compared by all their fields, e.g. their service name.
+func drift(previous commatrix.ComMatrix, current commatrix.ComMatrix) int {
+	byKey := func(m commatrix.ComMatrix) map[string]commatrix.ComDetails {
+		res := make(map[string]commatrix.ComDetails, len(m.Matrix))
+		for _, cd := range m.Matrix {
+			res[strings.Join([]string{cd.NodeRole, cd.NodeName, cd.Protocol, cd.Port}, "/")] = cd
+		}
+		return res
+	}
+
+	var (
+		res         = 0
+		previousCds = byKey(previous)
+		currentCds  = byKey(current)
+	)
+	for key, cd := range currentCds {
+		if p, ok := previousCds[key]; !ok || p != cd {
+			res++
+		}
+	}
+	for key := range previousCds {
+		if _, ok := currentCds[key]; !ok {
+			res++
+		}
+	}
+
+	return res
+}
+
+// equalEntries returns whether the entries are the same, in the same order.
+func equalEntries(a []v1alpha1.Entry, b []v1alpha1.Entry) bool {
+	return (len(a) == 0 && len(b) == 0) || reflect.DeepEqual(a, b)
+}
+
+// SetupWithManager registers the Reconciler with the manager, watching the objects the matrix is
+// generated from and the written object.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	opts, err := r.Options.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	enqueue := handler.EnqueueRequestsFromMapFunc(func(context.Context, runtimeclient.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: opts.Namespace, Name: opts.Name}}}
+	})
+
+	var output runtimeclient.Object = &v1alpha1.CommunicationMatrix{}
+	if opts.Output == OutputConfigMap {
+		output = &corev1.ConfigMap{}
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("commatrix").
+		Watches(output, enqueue, builder.WithPredicates(outputPredicate(opts), predicate.GenerationChangedPredicate{})).
+		Watches(&discoveryv1.EndpointSlice{}, enqueue, builder.WithPredicates(sourcePredicate())).
+		Watches(&corev1.Service{}, enqueue, builder.WithPredicates(sourcePredicate())).
+		Watches(&corev1.Node{}, enqueue, builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Watches(&corev1.Pod{}, enqueue, builder.WithPredicates(hostNetworkPodPredicate())).
+		Complete(r)
+}
+
+// sourcePredicate filters the updates of the EndpointSlices and Services that change neither their
+// generation nor their labels, which select the ingress EndpointSlices and name the services.
+func sourcePredicate() predicate.Predicate {
+	return predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{})
+}
+
+// outputPredicate filters the events of the written object.
+func outputPredicate(opts Options) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj runtimeclient.Object) bool {
+		if obj.GetName() != opts.Name {
+			return false
+		}
+		_, isConfigMap := obj.(*corev1.ConfigMap)
+		return !isConfigMap || obj.GetNamespace() == opts.Namespace
+	})
+}
+
+// hostNetworkPodPredicate filters the creation and deletion of host network pods, the only pod
+// events changing the EndpointSlices query results.
+func hostNetworkPodPredicate() predicate.Predicate {
+	isHostNetwork := func(obj runtimeclient.Object) bool {
+		pod, ok := obj.(*corev1.Pod)
+		return ok && pod.Spec.HostNetwork
+	}
+
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return isHostNetwork(e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return isHostNetwork(e.Object) },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
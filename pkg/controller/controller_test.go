@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/liornoy/node-comm-lib/pkg/api/v1alpha1"
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/fakeclient"
+)
+
+func ingressEndpointSlice(name string, nodeName string, port int32) discoveryv1.EndpointSlice {
+	cd := commatrix.ComDetails{Protocol: "TCP"}
+	return cd.ToEndpointSlice(name, "default", nodeName, map[string]string{consts.IngressLabel: ""}, int(port))
+}
+
+func newReconciler(t *testing.T, opts Options) (*Reconciler, *record.FakeRecorder) {
+	c, err := fakeclient.New(fakeclient.ObjectsFromResources(fakeclient.ClusterResources{
+		EpSlices: []discoveryv1.EndpointSlice{ingressEndpointSlice("apiserver", "master-0", 6443)},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+
+	fakeCS := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "master-0", Labels: map[string]string{consts.MasterRole: ""}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Labels: map[string]string{consts.WorkerRole: ""}}},
+	)
+	recorder := record.NewFakeRecorder(10)
+
+	return &Reconciler{
+		ClientSet: &client.ClientSet{CoreV1Interface: fakeCS.CoreV1(), Client: c},
+		Recorder:  recorder,
+		Options:   opts,
+	}, recorder
+}
+
+// reconcileNewPort reconciles the initial cluster, adds an EndpointSlice with a new worker port and reconciles again.
+func reconcileNewPort(t *testing.T, r *Reconciler) {
+	ctx := context.TODO()
+	if _, err := r.Reconcile(ctx, reconcile.Request{}); err != nil {
+		t.Fatalf("failed to reconcile: %s", err)
+	}
+
+	epSlice := ingressEndpointSlice("bgp", "worker-0", 179)
+	if err := r.Create(ctx, &epSlice); err != nil {
+		t.Fatalf("failed to create EndpointSlice: %s", err)
+	}
+
+	if _, err := r.Reconcile(ctx, reconcile.Request{}); err != nil {
+		t.Fatalf("failed to reconcile: %s", err)
+	}
+}
+
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, expected []string) {
+	for _, prefix := range expected {
+		select {
+		case e := <-recorder.Events:
+			if !strings.HasPrefix(e, prefix) {
+				t.Fatalf("got event %q, expected %q", e, prefix)
+			}
+		default:
+			t.Fatalf("expected event %q", prefix)
+		}
+	}
+
+	select {
+	case e := <-recorder.Events:
+		t.Fatalf("unexpected event %q", e)
+	default:
+	}
+}
+
+func TestReconcileCommunicationMatrix(t *testing.T) {
+	r, recorder := newReconciler(t, Options{})
+	reconcileNewPort(t, r)
+
+	cm := &v1alpha1.CommunicationMatrix{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "commatrix"}, cm); err != nil {
+		t.Fatalf("failed to get CommunicationMatrix: %s", err)
+	}
+
+	expected := []v1alpha1.Entry{
+		{Direction: "ingress", Protocol: "TCP", Port: 6443, NodeRole: "master", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: 179, NodeRole: "worker", Required: true},
+	}
+	if len(cm.Spec.Entries) != len(expected) || cm.Spec.Entries[0] != expected[0] || cm.Spec.Entries[1] != expected[1] {
+		t.Fatalf("got entries %v, expected %v", cm.Spec.Entries, expected)
+	}
+	if cm.Status.DriftCount != 1 || cm.Status.LastGenerated == nil || len(cm.Status.Conditions) != 1 {
+		t.Fatalf("got status %+v, expected a drift of 1 and a Generated condition", cm.Status)
+	}
+
+	expectEvents(t, recorder, []string{"Normal Generated Generated 1 entries", "Warning NewPort New port worker TCP/179"})
+}
+
+func TestReconcileConfigMap(t *testing.T) {
+	r, recorder := newReconciler(t, Options{Output: OutputConfigMap, Namespace: "default"})
+	reconcileNewPort(t, r)
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "commatrix"}, cm); err != nil {
+		t.Fatalf("failed to get ConfigMap: %s", err)
+	}
+
+	m, err := commatrix.FromJSON([]byte(cm.Data[MatrixKey]))
+	if err != nil {
+		t.Fatalf("failed to parse matrix: %s", err)
+	}
+	if len(m.Matrix) != 2 || m.Metadata == nil {
+		t.Fatalf("got matrix %+v, expected 2 entries with metadata", m)
+	}
+
+	expectEvents(t, recorder, []string{"Normal Generated Generated 1 entries", "Warning NewPort New port worker TCP/179"})
+}
+
+func TestReconcileChangedServiceName(t *testing.T) {
+	for _, output := range []string{OutputCommunicationMatrix, OutputConfigMap} {
+		ctx := context.TODO()
+		r, recorder := newReconciler(t, Options{Output: output, Namespace: "default"})
+		if _, err := r.Reconcile(ctx, reconcile.Request{}); err != nil {
+			t.Fatalf("test \"%s\" failed: failed to reconcile: %s", output, err)
+		}
+
+		epSlice := &discoveryv1.EndpointSlice{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "apiserver"}, epSlice); err != nil {
+			t.Fatalf("test \"%s\" failed: failed to get EndpointSlice: %s", output, err)
+		}
+		epSlice.Labels["kubernetes.io/service-name"] = "kube-apiserver"
+		if err := r.Update(ctx, epSlice); err != nil {
+			t.Fatalf("test \"%s\" failed: failed to update EndpointSlice: %s", output, err)
+		}
+
+		if _, err := r.Reconcile(ctx, reconcile.Request{}); err != nil {
+			t.Fatalf("test \"%s\" failed: failed to reconcile: %s", output, err)
+		}
+
+		var m commatrix.ComMatrix
+		if output == OutputConfigMap {
+			cm := &corev1.ConfigMap{}
+			if err := r.Get(ctx, types.NamespacedName{Namespace: "default", Name: "commatrix"}, cm); err != nil {
+				t.Fatalf("test \"%s\" failed: failed to get ConfigMap: %s", output, err)
+			}
+			var err error
+			if m, err = commatrix.FromJSON([]byte(cm.Data[MatrixKey])); err != nil {
+				t.Fatalf("test \"%s\" failed: failed to parse matrix: %s", output, err)
+			}
+		} else {
+			cm := &v1alpha1.CommunicationMatrix{}
+			if err := r.Get(ctx, types.NamespacedName{Name: "commatrix"}, cm); err != nil {
+				t.Fatalf("test \"%s\" failed: failed to get CommunicationMatrix: %s", output, err)
+			}
+			if cm.Status.DriftCount != 1 {
+				t.Fatalf("test \"%s\" failed: got a drift of %d, expected 1", output, cm.Status.DriftCount)
+			}
+			m = cm.ToComMatrix()
+		}
+
+		if len(m.Matrix) != 1 || m.Matrix[0].ServiceName != "kube-apiserver" {
+			t.Fatalf("test \"%s\" failed: got matrix %v, expected the kube-apiserver service name", output, m.Matrix)
+		}
+
+		// The port itself did not change, so no NewPort or RemovedPort event is raised.
+		expectEvents(t, recorder, []string{"Normal Generated Generated 1 entries"})
+	}
+}
+
+func TestSourcePredicateLabelChange(t *testing.T) {
+	old := ingressEndpointSlice("apiserver", "master-0", 6443)
+	old.Generation = 1
+
+	labelChanged := old.DeepCopy()
+	labelChanged.Labels = map[string]string{consts.IngressLabel: "", "kubernetes.io/service-name": "kube-apiserver"}
+
+	unchanged := old.DeepCopy()
+	unchanged.ResourceVersion = "2"
+
+	tests := []struct {
+		desc     string
+		new      *discoveryv1.EndpointSlice
+		expected bool
+	}{
+		{desc: "label changed", new: labelChanged, expected: true},
+		{desc: "metadata unchanged", new: unchanged, expected: false},
+	}
+
+	for _, test := range tests {
+		e := event.UpdateEvent{ObjectOld: &old, ObjectNew: test.new}
+		if res := sourcePredicate().Update(e); res != test.expected {
+			t.Fatalf("test \"%s\" failed: got %v, expected %v", test.desc, res, test.expected)
+		}
+	}
+}
+
+func TestReconcileNoEndpointSlices(t *testing.T) {
+	for _, output := range []string{OutputCommunicationMatrix, OutputConfigMap} {
+		ctx := context.TODO()
+		r, recorder := newReconciler(t, Options{Output: output, Namespace: "default"})
+		if _, err := r.Reconcile(ctx, reconcile.Request{}); err != nil {
+			t.Fatalf("test \"%s\" failed: failed to reconcile: %s", output, err)
+		}
+
+		epSlice := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "apiserver"}}
+		if err := r.Delete(ctx, epSlice); err != nil {
+			t.Fatalf("test \"%s\" failed: failed to delete EndpointSlice: %s", output, err)
+		}
+
+		if _, err := r.Reconcile(ctx, reconcile.Request{}); err != nil {
+			t.Fatalf("test \"%s\" failed: got error %s, expected no error without EndpointSlices", output, err)
+		}
+
+		if output == OutputCommunicationMatrix {
+			cm := &v1alpha1.CommunicationMatrix{}
+			if err := r.Get(ctx, types.NamespacedName{Name: "commatrix"}, cm); err != nil {
+				t.Fatalf("test \"%s\" failed: failed to get CommunicationMatrix: %s", output, err)
+			}
+			cond := meta.FindStatusCondition(cm.Status.Conditions, ConditionGenerated)
+			if len(cm.Spec.Entries) != 1 || cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonNoEndpointSlices {
+				t.Fatalf("test \"%s\" failed: got entries %v and condition %+v, expected the previous entries and a NoEndpointSlices condition", output, cm.Spec.Entries, cond)
+			}
+		}
+
+		expectEvents(t, recorder, []string{"Normal Generated Generated 1 entries"})
+	}
+}
+
+func TestInvalidOutput(t *testing.T) {
+	r, _ := newReconciler(t, Options{Output: "Secret"})
+	_, err := r.Reconcile(context.TODO(), reconcile.Request{})
+	if err == nil || !strings.Contains(err.Error(), "invalid output") {
+		t.Fatalf("got error %v, expected an invalid output error", err)
+	}
+}
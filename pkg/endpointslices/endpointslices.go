@@ -3,6 +3,8 @@ package endpointslices
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
@@ -22,6 +24,7 @@ type QueryParams struct {
 	filter   []bool
 	epSlices []discoveryv1.EndpointSlice
 	services []corev1.Service
+	params   []string
 }
 
 func NewQuery(c client.Client) (*QueryParams, error) {
@@ -71,7 +74,19 @@ func (q *QueryParams) Query() []discoveryv1.EndpointSlice {
 	return ret
 }
 
+// Params returns the filters applied by the query, e.g. "hostNetwork" or "serviceType=NodePort".
+func (q *QueryParams) Params() []string {
+	return append([]string{}, q.params...)
+}
+
 func (q *QueryParams) WithLabels(labels map[string]string) QueryBuilder {
+	selector := make([]string, 0, len(labels))
+	for key, value := range labels {
+		selector = append(selector, key+"="+value)
+	}
+	sort.Strings(selector)
+	q.params = append(q.params, "labels="+strings.Join(selector, ","))
+
 	for i, epSlice := range q.epSlices {
 		if q.withLabels(epSlice, labels) {
 			q.filter[i] = true
@@ -82,6 +97,7 @@ func (q *QueryParams) WithLabels(labels map[string]string) QueryBuilder {
 }
 
 func (q *QueryParams) WithHostNetwork() QueryBuilder {
+	q.params = append(q.params, "hostNetwork")
 	for i, epSlice := range q.epSlices {
 		if q.withHostNetwork(epSlice) {
 			q.filter[i] = true
@@ -92,6 +108,7 @@ func (q *QueryParams) WithHostNetwork() QueryBuilder {
 }
 
 func (q *QueryParams) WithServiceType(serviceType corev1.ServiceType) QueryBuilder {
+	q.params = append(q.params, "serviceType="+string(serviceType))
 	for i, epSlice := range q.epSlices {
 		if q.withServiceType(epSlice, serviceType) {
 			q.filter[i] = true
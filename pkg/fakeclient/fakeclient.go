@@ -8,6 +8,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/liornoy/node-comm-lib/pkg/api/v1alpha1"
 )
 
 var scheme *runtime.Scheme
@@ -29,9 +31,14 @@ func New(initObjects []client.Object) (client.Client, error) {
 		return nil, fmt.Errorf("discoveryv1: add to scheme failed: %v", err)
 	}
 
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("v1alpha1: add to scheme failed: %v", err)
+	}
+
 	return fake.NewClientBuilder().
 		WithScheme(scheme).
 		WithObjects(initObjects...).
+		WithStatusSubresource(&v1alpha1.CommunicationMatrix{}).
 		Build(), nil
 }
 
@@ -0,0 +1,99 @@
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// Port is a protocol and port pair.
+type Port struct {
+	Protocol string
+	Port     string
+}
+
+// Renderer renders the firewall rules allowing the ports of the ComDetails.
+type Renderer func(cds []commatrix.ComDetails) (string, error)
+
+// RulesByRole returns the rules rendered per node role, each allowing only the ports of that role that
+// are not bound to any node. It fails if a ComDetails has no node role.
+func RulesByRole(cds []commatrix.ComDetails, render Renderer) (map[string]string, error) {
+	if err := commatrix.RequireNodeRoles(cds); err != nil {
+		return nil, fmt.Errorf("failed to create rules: %w", err)
+	}
+
+	return rulesByKey(commatrix.GroupByRole(cds), render)
+}
+
+// RulesByNode returns the rules rendered per node that has ComDetails with its NodeName set.
+// The rules of a node allow its own ports and the ports of its role that are not bound to any node.
+func RulesByNode(cds []commatrix.ComDetails, render Renderer) (map[string]string, error) {
+	return rulesByKey(commatrix.GroupByNode(cds), render)
+}
+
+// WriteRulesToDir writes the rules of every name to a "<name><ext>" file in dir, creating dir if needed.
+func WriteRulesToDir(rules map[string]string, dir string, ext string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create rules directory: %w", err)
+	}
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" || filepath.Base(name) != name {
+			return fmt.Errorf("invalid rules name %q", name)
+		}
+
+		err := os.WriteFile(filepath.Join(dir, name+ext), []byte(rules[name]), 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to write rules %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidatePort returns an error if the port is not a number between 1 and 65535.
+func ValidatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	return nil
+}
+
+// ValidateAllowedPort returns an error if a port allowed by the firewall generators regardless of the
+// matrix is not a valid TCP or UDP port.
+func ValidateAllowedPort(p Port) error {
+	if p.Protocol != "TCP" && p.Protocol != "UDP" {
+		return fmt.Errorf("invalid always allowed port %s/%s: unsupported protocol", p.Protocol, p.Port)
+	}
+	if err := ValidatePort(p.Port); err != nil {
+		return fmt.Errorf("invalid always allowed port: %w", err)
+	}
+
+	return nil
+}
+
+func rulesByKey(cdsByKey map[string][]commatrix.ComDetails, render Renderer) (map[string]string, error) {
+	res := make(map[string]string, len(cdsByKey))
+	for key, cds := range cdsByKey {
+		rules, err := render(cds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rules for %s: %w", key, err)
+		}
+		res[key] = rules
+	}
+
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package firewall
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+func TestRulesByRoleAndNode(t *testing.T) {
+	cds := []commatrix.ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+		{Direction: "ingress", Protocol: "UDP", Port: "319", NodeRole: "worker", ServiceName: "ptp4l", Required: true, NodeName: "worker-0"},
+	}
+	render := func(cds []commatrix.ComDetails) (string, error) {
+		res := ""
+		for _, cd := range cds {
+			res += cd.Protocol + "/" + cd.Port + " "
+		}
+		return res, nil
+	}
+
+	byRole, err := RulesByRole(cds, render)
+	if err != nil {
+		t.Fatalf("failed to render rules by role: %s", err)
+	}
+	expected := map[string]string{"master": "TCP/6443 ", "worker": "TCP/10250 "}
+	if !reflect.DeepEqual(byRole, expected) {
+		t.Fatalf("got %v, expected %v", byRole, expected)
+	}
+
+	byNode, err := RulesByNode(cds, render)
+	if err != nil {
+		t.Fatalf("failed to render rules by node: %s", err)
+	}
+	expected = map[string]string{"worker-0": "TCP/10250 UDP/319 "}
+	if !reflect.DeepEqual(byNode, expected) {
+		t.Fatalf("got %v, expected %v", byNode, expected)
+	}
+
+	if _, err := RulesByRole([]commatrix.ComDetails{{Protocol: "TCP", Port: "22"}}, render); err == nil {
+		t.Fatalf("expected an error for ComDetails without a node role")
+	}
+}
+
+func TestWriteRulesToDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rules")
+
+	err := WriteRulesToDir(map[string]string{"master": "master rules"}, dir, ".rules")
+	if err != nil {
+		t.Fatalf("failed to write rules: %s", err)
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "master.rules"))
+	if err != nil || string(out) != "master rules" {
+		t.Fatalf("got %q (err: %v), expected \"master rules\"", out, err)
+	}
+
+	if err := WriteRulesToDir(map[string]string{"../escape": ""}, dir, ".rules"); err == nil {
+		t.Fatalf("expected error for rules name with a path")
+	}
+}
+
+func TestValidateAllowedPort(t *testing.T) {
+	if err := ValidateAllowedPort(Port{Protocol: "SCTP", Port: "22"}); err == nil {
+		t.Fatalf("expected an error for an SCTP always allowed port")
+	}
+	if err := ValidatePort("0"); err == nil {
+		t.Fatalf("expected an error for port 0")
+	}
+	if err := ValidateAllowedPort(Port{Protocol: "TCP", Port: "22"}); err != nil {
+		t.Fatalf("got error %v for TCP port 22", err)
+	}
+}
@@ -0,0 +1,335 @@
+package firewalld
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+const (
+	defaultPrefix = "commatrix-"
+	defaultTarget = "DROP"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// portProtocols are the protocols rendered as ports, the rows of other protocols, such as ICMP or VRRP,
+// are rendered as protocols regardless of their port.
+var portProtocols = map[string]bool{"tcp": true, "udp": true, "sctp": true}
+
+// protocolNames maps the ComDetails protocols whose firewalld name is not their lower case name.
+var protocolNames = map[string]string{"icmpv6": "ipv6-icmp"}
+
+// Options controls the generated firewalld services and zones.
+type Options struct {
+	// Prefix is prepended to the service and zone names to avoid clashing with the
+	// services and zones shipped with firewalld, defaults to "commatrix-".
+	Prefix string
+	// Target is the zone target applied to the traffic no service matches: DROP (default),
+	// default, ACCEPT or %%REJECT%%.
+	Target string
+	// ZoneServices are existing firewalld services added to every zone.
+	// Nil defaults to ssh, an empty slice adds no service.
+	ZoneServices []string
+}
+
+// Service is a firewalld service, as stored in /etc/firewalld/services.
+type Service struct {
+	XMLName     xml.Name   `xml:"service"`
+	Short       string     `xml:"short"`
+	Description string     `xml:"description,omitempty"`
+	Ports       []Port     `xml:"port"`
+	Protocols   []Protocol `xml:"protocol"`
+}
+
+// Zone is a firewalld zone, as stored in /etc/firewalld/zones.
+type Zone struct {
+	XMLName     xml.Name         `xml:"zone"`
+	Target      string           `xml:"target,attr,omitempty"`
+	Short       string           `xml:"short"`
+	Description string           `xml:"description,omitempty"`
+	Services    []ServiceElement `xml:"service"`
+	Ports       []Port           `xml:"port"`
+	Protocols   []Protocol       `xml:"protocol"`
+}
+
+// ServiceElement references a service from a zone.
+type ServiceElement struct {
+	Name string `xml:"name,attr"`
+}
+
+type Port struct {
+	Protocol string `xml:"protocol,attr"`
+	Port     string `xml:"port,attr"`
+}
+
+// Protocol allows all the traffic of an IP protocol without ports, e.g. icmp or vrrp.
+type Protocol struct {
+	Value string `xml:"value,attr"`
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Prefix == "" {
+		o.Prefix = defaultPrefix
+	}
+	if o.Target == "" {
+		o.Target = defaultTarget
+	}
+	if o.ZoneServices == nil {
+		o.ZoneServices = []string{"ssh"}
+	}
+
+	switch o.Target {
+	case "default", "ACCEPT", "DROP", "%%REJECT%%":
+	default:
+		return o, fmt.Errorf("unsupported zone target %q", o.Target)
+	}
+
+	if invalidNameChars.MatchString(o.Prefix) {
+		return o, fmt.Errorf("invalid prefix %q", o.Prefix)
+	}
+
+	for _, s := range o.ZoneServices {
+		if s == "" || invalidNameChars.MatchString(s) {
+			return o, fmt.Errorf("invalid zone service %q", s)
+		}
+	}
+
+	return o, nil
+}
+
+// GetServices returns a service per ServiceName of the ComDetails, allowing all the ports of the ServiceName.
+func GetServices(cds []commatrix.ComDetails, opts Options) (map[string]Service, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := servicePorts(cds, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]Service, len(ports))
+	for name, ps := range ports {
+		servicePorts, protocols := splitProtocols(ps)
+		res[name] = Service{
+			Short:       name,
+			Description: "Generated from the communication matrix.",
+			Ports:       servicePorts,
+			Protocols:   protocols,
+		}
+	}
+
+	return res, nil
+}
+
+// GetZones returns a zone per node role. A zone references the services of its role, unless the service
+// has ports of other roles too, in which case the ports of the role are added to the zone directly.
+func GetZones(cds []commatrix.ComDetails, opts Options) (map[string]Zone, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := commatrix.RequireNodeRoles(cds); err != nil {
+		return nil, fmt.Errorf("failed to create zones: %w", err)
+	}
+
+	allPorts, err := servicePorts(cds, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res   = make(map[string]Zone)
+		roles = make(map[string]string)
+	)
+	for role, roleCds := range commatrix.GroupByRole(cds) {
+		roleName := opts.Prefix + sanitize(role)
+		if other, ok := roles[roleName]; ok {
+			return nil, fmt.Errorf("node roles %q and %q have the same zone name %s", other, role, roleName)
+		}
+		roles[roleName] = role
+
+		zone := Zone{
+			Target:      opts.Target,
+			Short:       roleName,
+			Description: fmt.Sprintf("Generated from the communication matrix for the %s nodes.", role),
+			Services:    make([]ServiceElement, 0),
+			Ports:       make([]Port, 0),
+		}
+		for _, s := range opts.ZoneServices {
+			zone.Services = append(zone.Services, ServiceElement{Name: s})
+		}
+
+		// servicePorts cannot fail for the ComDetails of a role once it succeeded for all the ComDetails.
+		rolePorts, _ := servicePorts(roleCds, opts)
+		names := make([]string, 0, len(rolePorts))
+		for name := range rolePorts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if len(rolePorts[name]) == len(allPorts[name]) {
+				zone.Services = append(zone.Services, ServiceElement{Name: name})
+				continue
+			}
+			ports, protocols := splitProtocols(rolePorts[name])
+			zone.Ports = append(zone.Ports, ports...)
+			zone.Protocols = append(zone.Protocols, protocols...)
+		}
+
+		res[roleName] = zone
+	}
+
+	return res, nil
+}
+
+// WriteToDir writes the services to "<dir>/services/<name>.xml" and the zones to "<dir>/zones/<name>.xml",
+// matching the layout of /etc/firewalld.
+func WriteToDir(cds []commatrix.ComDetails, opts Options, dir string) error {
+	services, err := GetServices(cds, opts)
+	if err != nil {
+		return err
+	}
+
+	zones, err := GetZones(cds, opts)
+	if err != nil {
+		return err
+	}
+
+	for name, service := range services {
+		err := writeXML(filepath.Join(dir, "services"), name, service)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, zone := range zones {
+		err := writeXML(filepath.Join(dir, "zones"), name, zone)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToXML returns the service or zone in the firewalld XML format.
+func ToXML(v interface{}) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to XML format: %w", err)
+	}
+
+	return append(append([]byte(xml.Header), out...), '\n'), nil
+}
+
+func writeXML(dir string, name string, v interface{}) error {
+	out, err := ToXML(v)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, name+".xml"), out, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// servicePorts returns the sorted ports of every service, by the prefixed and sanitized service name.
+// The rows of protocols without ports are returned as ports without port number.
+func servicePorts(cds []commatrix.ComDetails, opts Options) (map[string][]Port, error) {
+	var (
+		res      = make(map[string][]Port)
+		seen     = make(map[string]bool)
+		services = make(map[string]string)
+	)
+	for _, cd := range cds {
+		protocol := strings.ToLower(cd.Protocol)
+		if name, ok := protocolNames[protocol]; ok {
+			protocol = name
+		}
+
+		port := cd.Port
+		if !portProtocols[protocol] {
+			if protocol == "" || invalidNameChars.MatchString(protocol) {
+				return nil, fmt.Errorf("invalid ComDetails %s: invalid protocol %q", cd, cd.Protocol)
+			}
+			port = ""
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid ComDetails %s: invalid port %q", cd, cd.Port)
+		}
+
+		name := opts.Prefix + sanitize(cd.ServiceName)
+		if other, ok := services[name]; ok && other != cd.ServiceName {
+			return nil, fmt.Errorf("services %q and %q have the same firewalld name %s", other, cd.ServiceName, name)
+		}
+		services[name] = cd.ServiceName
+
+		key := name + "/" + protocol + "/" + port
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		res[name] = append(res[name], Port{Protocol: protocol, Port: port})
+	}
+
+	for _, ports := range res {
+		sort.Slice(ports, func(i, j int) bool {
+			if ports[i].Protocol != ports[j].Protocol {
+				return ports[i].Protocol < ports[j].Protocol
+			}
+			a, _ := strconv.Atoi(ports[i].Port)
+			b, _ := strconv.Atoi(ports[j].Port)
+			return a < b
+		})
+	}
+
+	return res, nil
+}
+
+// splitProtocols splits the ports returned by servicePorts to ports and protocols.
+func splitProtocols(ports []Port) ([]Port, []Protocol) {
+	var (
+		res       = make([]Port, 0, len(ports))
+		protocols = make([]Protocol, 0)
+	)
+	for _, p := range ports {
+		if p.Port == "" {
+			protocols = append(protocols, Protocol{Value: p.Protocol})
+			continue
+		}
+		res = append(res, p)
+	}
+
+	return res, protocols
+}
+
+// sanitize returns the name in lower case, with the characters firewalld does not accept in
+// file names replaced by dashes.
+func sanitize(name string) string {
+	name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" {
+		return "unknown"
+	}
+
+	return name
+}
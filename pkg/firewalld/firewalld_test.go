@@ -0,0 +1,176 @@
+package firewalld
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+var testComDetails = []commatrix.ComDetails{
+	{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "2380", NodeRole: "master", ServiceName: "etcd", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "2379", NodeRole: "master", ServiceName: "etcd", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "master", ServiceName: "kubelet", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+	{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "worker", ServiceName: "ovn", Required: true},
+	{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "master", ServiceName: "ovn", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", ServiceName: "node/exporter", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "9101", NodeRole: "master", ServiceName: "node/exporter", Required: true},
+}
+
+func TestGetServices(t *testing.T) {
+	services, err := GetServices(testComDetails, Options{})
+	if err != nil {
+		t.Fatalf("failed to get services: %s", err)
+	}
+
+	out, err := ToXML(services["commatrix-etcd"])
+	if err != nil {
+		t.Fatalf("failed to convert service to XML: %s", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<service>
+  <short>commatrix-etcd</short>
+  <description>Generated from the communication matrix.</description>
+  <port protocol="tcp" port="2379"></port>
+  <port protocol="tcp" port="2380"></port>
+</service>
+`
+	if string(out) != expected {
+		t.Fatalf("got:\n%s\nexpected:\n%s", out, expected)
+	}
+
+	if _, ok := services["commatrix-node-exporter"]; !ok || len(services) != 5 {
+		t.Fatalf("unexpected services: %v", services)
+	}
+}
+
+func TestGetZones(t *testing.T) {
+	zones, err := GetZones(testComDetails, Options{})
+	if err != nil {
+		t.Fatalf("failed to get zones: %s", err)
+	}
+
+	tests := []struct {
+		zone     string
+		services []ServiceElement
+		ports    []Port
+	}{
+		{
+			zone:     "commatrix-master",
+			services: []ServiceElement{{"ssh"}, {"commatrix-etcd"}, {"commatrix-kubelet"}, {"commatrix-kubernetes"}, {"commatrix-ovn"}},
+			ports:    []Port{{Protocol: "tcp", Port: "9101"}},
+		},
+		{
+			zone:     "commatrix-worker",
+			services: []ServiceElement{{"ssh"}, {"commatrix-kubelet"}, {"commatrix-ovn"}},
+			ports:    []Port{{Protocol: "tcp", Port: "9100"}},
+		},
+	}
+
+	for _, test := range tests {
+		zone, ok := zones[test.zone]
+		if !ok {
+			t.Fatalf("test \"%s\" failed: zone not found", test.zone)
+		}
+		if zone.Target != "DROP" {
+			t.Fatalf("test \"%s\" failed: got target %s, expected DROP", test.zone, zone.Target)
+		}
+		if !reflect.DeepEqual(zone.Services, test.services) {
+			t.Fatalf("test \"%s\" failed: got services %v, expected %v", test.zone, zone.Services, test.services)
+		}
+		if !reflect.DeepEqual(zone.Ports, test.ports) {
+			t.Fatalf("test \"%s\" failed: got ports %v, expected %v", test.zone, zone.Ports, test.ports)
+		}
+	}
+}
+
+func TestWriteToDir(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WriteToDir(testComDetails, Options{}, dir)
+	if err != nil {
+		t.Fatalf("failed to write firewalld files: %s", err)
+	}
+
+	for _, path := range []string{"services/commatrix-kubelet.xml", "zones/commatrix-worker.xml"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Fatalf("expected %s to be written: %s", path, err)
+		}
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	tests := []struct {
+		desc string
+		cds  []commatrix.ComDetails
+		opts Options
+	}{
+		{
+			desc: "invalid port",
+			cds:  []commatrix.ComDetails{{Protocol: "TCP", Port: "22\"/>"}},
+		},
+		{
+			desc: "invalid target",
+			opts: Options{Target: "REJECT"},
+		},
+		{
+			desc: "invalid zone service",
+			opts: Options{ZoneServices: []string{"ssh\"/>"}},
+		},
+		{
+			desc: "services with the same name",
+			cds: []commatrix.ComDetails{
+				{Protocol: "TCP", Port: "80", NodeRole: "worker", ServiceName: "Foo.Bar"},
+				{Protocol: "TCP", Port: "81", NodeRole: "worker", ServiceName: "foo-bar"},
+			},
+		},
+		{
+			desc: "roles with the same name",
+			cds: []commatrix.ComDetails{
+				{Protocol: "TCP", Port: "80", NodeRole: "infra.a", ServiceName: "http"},
+				{Protocol: "TCP", Port: "80", NodeRole: "infra-a", ServiceName: "http"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := GetZones(test.cds, test.opts); err == nil {
+			t.Fatalf("test \"%s\" failed: expected error", test.desc)
+		}
+	}
+}
+
+func TestProtocolServices(t *testing.T) {
+	cds := []commatrix.ComDetails{
+		{Direction: "ingress", Protocol: "ICMP", NodeRole: "worker", ServiceName: "ping", Required: true},
+		{Direction: "ingress", Protocol: "ICMPv6", NodeRole: "worker", ServiceName: "ping", Required: true},
+		{Direction: "ingress", Protocol: "VRRP", NodeRole: "master", ServiceName: "keepalived", Required: true},
+		{Direction: "ingress", Protocol: "VRRP", NodeRole: "worker", ServiceName: "keepalived", Required: true},
+		{Direction: "ingress", Protocol: "TCP", Port: "1936", NodeRole: "worker", ServiceName: "keepalived", Required: true},
+	}
+
+	services, err := GetServices(cds, Options{})
+	if err != nil {
+		t.Fatalf("failed to get services: %s", err)
+	}
+
+	expected := []Protocol{{Value: "icmp"}, {Value: "ipv6-icmp"}}
+	if ping := services["commatrix-ping"]; len(ping.Ports) != 0 || !reflect.DeepEqual(ping.Protocols, expected) {
+		t.Fatalf("got service %+v, expected the protocols %v", ping, expected)
+	}
+
+	zones, err := GetZones(cds, Options{})
+	if err != nil {
+		t.Fatalf("failed to get zones: %s", err)
+	}
+
+	master := zones["commatrix-master"]
+	if !reflect.DeepEqual(master.Protocols, []Protocol{{Value: "vrrp"}}) || len(master.Ports) != 0 {
+		t.Fatalf("got master zone %+v, expected the vrrp protocol only", master)
+	}
+}
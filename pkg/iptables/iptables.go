@@ -0,0 +1,165 @@
+package iptables
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+// maxMultiportPorts is the maximum number of ports the multiport match accepts.
+const maxMultiportPorts = 15
+
+// GetRules returns the rules allowing the ports of the ComDetails in the iptables-restore format
+// (ip6tables-restore for the ipv6 family). The rules are loaded into a dedicated chain that ends
+// with a drop rule, and are meant to be loaded with `iptables-restore --noflush` so the other
+// chains of the filter table are kept.
+func GetRules(cds []commatrix.ComDetails, opts Options) (string, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return "", err
+	}
+
+	err = validateComDetails(cds)
+	if err != nil {
+		return "", err
+	}
+
+	err = opts.Sources.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	rules := baseRules(opts)
+
+	var (
+		tcpPorts    = make([]string, 0)
+		udpPorts    = make([]string, 0)
+		sourcePorts = make(map[string][]string)
+		sourceKeys  = make([]string, 0)
+		sourceRules = make(map[string]policy.ResolvedRule)
+		seen        = make(map[string]bool)
+	)
+	for _, cd := range cds {
+		key := cd.Protocol + "/" + cd.Port
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if cd.Protocol != "TCP" && cd.Protocol != "UDP" {
+			continue
+		}
+
+		rule, ok := opts.Sources.Match(cd)
+		if !ok {
+			if cd.Protocol == "TCP" {
+				tcpPorts = append(tcpPorts, cd.Port)
+			} else {
+				udpPorts = append(udpPorts, cd.Port)
+			}
+			continue
+		}
+
+		sourceKey := rule.Name + "/" + cd.Protocol
+		if _, ok := sourcePorts[sourceKey]; !ok {
+			sourceKeys = append(sourceKeys, sourceKey)
+			sourceRules[sourceKey] = rule
+		}
+		sourcePorts[sourceKey] = append(sourcePorts[sourceKey], cd.Port)
+	}
+
+	rules = append(rules, portRules("", "tcp", tcpPorts)...)
+	rules = append(rules, portRules("", "udp", udpPorts)...)
+	for _, key := range sourceKeys {
+		rule := sourceRules[key]
+		cidrs := rule.IPv4
+		if opts.Family == "ipv6" {
+			cidrs = rule.IPv6
+		}
+
+		protocol := strings.ToLower(strings.SplitN(key, "/", 2)[1])
+		for _, cidr := range cidrs {
+			rules = append(rules, portRules(cidr, protocol, sourcePorts[key])...)
+		}
+	}
+	rules = append(rules, "-j DROP")
+
+	var out strings.Builder
+	out.WriteString("*filter\n")
+	fmt.Fprintf(&out, ":%s - [0:0]\n", opts.Chain)
+	if opts.JumpFromInput {
+		fmt.Fprintf(&out, "-I INPUT -j %s\n", opts.Chain)
+	}
+	for _, rule := range rules {
+		fmt.Fprintf(&out, "-A %s %s\n", opts.Chain, rule)
+	}
+	out.WriteString("COMMIT\n")
+
+	return out.String(), nil
+}
+
+// baseRules returns the rules accepting the traffic that is allowed regardless of the matrix.
+func baseRules(opts Options) []string {
+	res := make([]string, 0)
+	if !opts.SkipLoopback {
+		res = append(res, "-i lo -j ACCEPT")
+	}
+	if !opts.SkipEstablished {
+		res = append(res, "-m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT")
+	}
+	if !opts.DropICMP {
+		if opts.Family == "ipv6" {
+			res = append(res, "-p ipv6-icmp -j ACCEPT")
+		} else {
+			res = append(res, "-p icmp -j ACCEPT")
+		}
+	}
+	for _, p := range opts.AlwaysAllowedPorts {
+		res = append(res, portRules("", strings.ToLower(p.Protocol), []string{p.Port})...)
+	}
+
+	return res
+}
+
+// portRules returns the rules accepting the ports from the source, using the multiport match
+// for multiple ports, split to rules of at most maxMultiportPorts ports.
+func portRules(source string, protocol string, ports []string) []string {
+	prefix := ""
+	if source != "" {
+		prefix = "-s " + source + " "
+	}
+
+	res := make([]string, 0)
+	for len(ports) > 0 {
+		n := len(ports)
+		if n > maxMultiportPorts {
+			n = maxMultiportPorts
+		}
+
+		if n == 1 {
+			res = append(res, fmt.Sprintf("%s-p %s -m %s --dport %s -j ACCEPT", prefix, protocol, protocol, ports[0]))
+		} else {
+			res = append(res, fmt.Sprintf("%s-p %s -m multiport --dports %s -j ACCEPT", prefix, protocol, strings.Join(ports[:n], ",")))
+		}
+		ports = ports[n:]
+	}
+
+	return res
+}
+
+func validateComDetails(cds []commatrix.ComDetails) error {
+	for _, cd := range cds {
+		if cd.Protocol != "TCP" && cd.Protocol != "UDP" {
+			continue
+		}
+
+		if err := firewall.ValidatePort(cd.Port); err != nil {
+			return fmt.Errorf("invalid ComDetails %s: %w", cd, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package iptables
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+var testComDetails = []commatrix.ComDetails{
+	{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "2379", NodeRole: "master", ServiceName: "etcd", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "master", ServiceName: "kubelet", Required: true},
+	{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "master", ServiceName: "ovn", Required: true},
+}
+
+func TestGetRules(t *testing.T) {
+	sources := policy.Resolved{Rules: []policy.ResolvedRule{{
+		Rule: policy.Rule{Name: "etcd", Protocol: "TCP", Ports: []string{"2379"}},
+		IPv4: []string{"10.0.0.0/24"},
+		IPv6: []string{"fd00::/64"},
+	}}}
+
+	tests := []struct {
+		desc     string
+		opts     Options
+		expected string
+	}{
+		{
+			desc: "defaults",
+			opts: Options{},
+			expected: `*filter
+:COMMATRIX-INPUT - [0:0]
+-A COMMATRIX-INPUT -i lo -j ACCEPT
+-A COMMATRIX-INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A COMMATRIX-INPUT -p icmp -j ACCEPT
+-A COMMATRIX-INPUT -p tcp -m tcp --dport 22 -j ACCEPT
+-A COMMATRIX-INPUT -p tcp -m multiport --dports 6443,2379,10250 -j ACCEPT
+-A COMMATRIX-INPUT -p udp -m udp --dport 6081 -j ACCEPT
+-A COMMATRIX-INPUT -j DROP
+COMMIT
+`,
+		},
+		{
+			desc: "ipv6 with sources",
+			opts: Options{
+				Family:             "ipv6",
+				Chain:              "MATRIX",
+				JumpFromInput:      true,
+				AlwaysAllowedPorts: []firewall.Port{},
+				SkipEstablished:    true,
+				Sources:            sources,
+			},
+			expected: `*filter
+:MATRIX - [0:0]
+-I INPUT -j MATRIX
+-A MATRIX -i lo -j ACCEPT
+-A MATRIX -p ipv6-icmp -j ACCEPT
+-A MATRIX -p tcp -m multiport --dports 6443,10250 -j ACCEPT
+-A MATRIX -p udp -m udp --dport 6081 -j ACCEPT
+-A MATRIX -s fd00::/64 -p tcp -m tcp --dport 2379 -j ACCEPT
+-A MATRIX -j DROP
+COMMIT
+`,
+		},
+	}
+
+	for _, test := range tests {
+		rules, err := GetRules(testComDetails, test.opts)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.desc, err)
+		}
+		if rules != test.expected {
+			t.Fatalf("test \"%s\" failed: got:\n%s\nexpected:\n%s", test.desc, rules, test.expected)
+		}
+	}
+}
+
+func TestGetRulesMultiportLimit(t *testing.T) {
+	cds := make([]commatrix.ComDetails, 0)
+	for port := 1000; port < 1020; port++ {
+		cds = append(cds, commatrix.ComDetails{Protocol: "TCP", Port: fmt.Sprint(port), NodeRole: "worker"})
+	}
+
+	rules, err := GetRules(cds, Options{})
+	if err != nil {
+		t.Fatalf("failed to get rules: %s", err)
+	}
+
+	if strings.Count(rules, "-m multiport") != 2 {
+		t.Fatalf("expected the ports to be split into two multiport rules:\n%s", rules)
+	}
+}
+
+func TestGetRulesInvalidInput(t *testing.T) {
+	tests := []struct {
+		desc string
+		cds  []commatrix.ComDetails
+		opts Options
+	}{
+		{
+			desc: "invalid port",
+			cds:  []commatrix.ComDetails{{Protocol: "TCP", Port: "22 -j ACCEPT"}},
+		},
+		{
+			desc: "invalid family",
+			opts: Options{Family: "inet"},
+		},
+		{
+			desc: "invalid chain",
+			opts: Options{Chain: "IN PUT"},
+		},
+		{
+			desc: "invalid always allowed port",
+			opts: Options{AlwaysAllowedPorts: []firewall.Port{{Protocol: "SCTP", Port: "22"}}},
+		},
+		{
+			desc: "invalid source CIDR",
+			opts: Options{Sources: policy.Resolved{Rules: []policy.ResolvedRule{{
+				Rule: policy.Rule{Name: "etcd"},
+				IPv4: []string{"fd00::/64"},
+			}}}},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := GetRules(test.cds, test.opts); err == nil {
+			t.Fatalf("test \"%s\" failed: expected error", test.desc)
+		}
+	}
+}
+
+func TestGetRulesByNode(t *testing.T) {
+	cds := append(append([]commatrix.ComDetails{}, testComDetails...),
+		commatrix.ComDetails{Protocol: "TCP", Port: "9999", NodeRole: "master", NodeName: "master-0"})
+
+	rules, err := GetRulesByNode(cds, Options{})
+	if err != nil {
+		t.Fatalf("failed to get rules by node: %s", err)
+	}
+
+	if len(rules) != 1 || !strings.Contains(rules["master-0"], "6443,2379,10250,9999") {
+		t.Fatalf("unexpected rules by node: %v", rules)
+	}
+}
@@ -0,0 +1,70 @@
+package iptables
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+const (
+	defaultFamily = "ipv4"
+	defaultChain  = "COMMATRIX-INPUT"
+)
+
+// chainNameRegex matches the user defined chain names accepted by iptables.
+var chainNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,27}$`)
+
+// Options controls the generated rules. The zero value is a safe configuration:
+// SSH, loopback, ICMP and the return traffic of tracked connections are accepted.
+type Options struct {
+	// Family is the address family of the rules: ipv4 (default, iptables-restore) or ipv6 (ip6tables-restore).
+	Family string
+	// Chain is the name of the dedicated chain, defaults to COMMATRIX-INPUT.
+	Chain string
+	// JumpFromInput inserts a rule jumping from the INPUT chain to the dedicated chain. The INPUT chain
+	// is not flushed by `iptables-restore --noflush`, so the jump is inserted again on every load: use it
+	// for the first load only, and reload the rules without it.
+	JumpFromInput bool
+	// AlwaysAllowedPorts are accepted from any source regardless of the matrix.
+	// Nil defaults to SSH (TCP 22), an empty slice allows no additional port.
+	AlwaysAllowedPorts []firewall.Port
+	// SkipEstablished omits accepting the established and related connections.
+	SkipEstablished bool
+	// SkipLoopback omits accepting the traffic of the loopback interface.
+	SkipLoopback bool
+	// DropICMP omits accepting ICMP traffic of the family.
+	DropICMP bool
+	// Sources are the resolved source policy. Ports matching one of its rules are accepted only
+	// from the CIDRs of the rule, with a `-s` rule per CIDR.
+	Sources policy.Resolved
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Family == "" {
+		o.Family = defaultFamily
+	}
+	if o.Chain == "" {
+		o.Chain = defaultChain
+	}
+	if o.AlwaysAllowedPorts == nil {
+		o.AlwaysAllowedPorts = []firewall.Port{{Protocol: "TCP", Port: "22"}}
+	}
+
+	if o.Family != "ipv4" && o.Family != "ipv6" {
+		return o, fmt.Errorf("unsupported family %q", o.Family)
+	}
+
+	if !chainNameRegex.MatchString(o.Chain) {
+		return o, fmt.Errorf("invalid chain name %q", o.Chain)
+	}
+
+	for _, p := range o.AlwaysAllowedPorts {
+		if err := firewall.ValidateAllowedPort(p); err != nil {
+			return o, err
+		}
+	}
+
+	return o, nil
+}
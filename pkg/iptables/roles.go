@@ -0,0 +1,37 @@
+package iptables
+
+import (
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+)
+
+// GetRulesByRole returns the iptables-restore input per node role. The input of a role flushes and
+// refills the dedicated chain with the ports of that role that are not bound to any node, so loading
+// it replaces the rules of a previous load. It fails if a ComDetails has no node role.
+func GetRulesByRole(cds []commatrix.ComDetails, opts Options) (map[string]string, error) {
+	return firewall.RulesByRole(cds, renderer(opts))
+}
+
+// GetRulesByNode returns the iptables-restore input per node that has ComDetails with its NodeName set,
+// filling the dedicated chain with the ports of the node and the ports of its role that are not bound
+// to any node. Load it on that node instead of the input of its role.
+func GetRulesByNode(cds []commatrix.ComDetails, opts Options) (map[string]string, error) {
+	return firewall.RulesByNode(cds, renderer(opts))
+}
+
+// WriteRulesToDir writes every iptables-restore input to a "<name>.rules" file in dir, or to a
+// "<name>.v6.rules" file for ip6tables-restore when the family is ipv6, creating dir if needed.
+func WriteRulesToDir(rules map[string]string, family string, dir string) error {
+	ext := ".rules"
+	if family == "ipv6" {
+		ext = ".v6.rules"
+	}
+
+	return firewall.WriteRulesToDir(rules, dir, ext)
+}
+
+func renderer(opts Options) firewall.Renderer {
+	return func(cds []commatrix.ComDetails) (string, error) {
+		return GetRules(cds, opts)
+	}
+}
@@ -0,0 +1,235 @@
+package networkpolicy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+const (
+	defaultPrefix = "commatrix-"
+	// GeneratedLabel is set on the generated policies.
+	GeneratedLabel = "commatrix.io/generated"
+	// maxAdminNetworkPolicyPriority is the highest priority the AdminNetworkPolicy API accepts.
+	maxAdminNetworkPolicyPriority = 1000
+)
+
+// Options controls the generated policies.
+type Options struct {
+	// Prefix is prepended to the Service name to name its policy, defaults to "commatrix-".
+	Prefix string
+	// Namespaces restricts the policies to Services of these namespaces, all namespaces when empty.
+	Namespaces []string
+	// AdminNetworkPolicyPriority is the priority of the first generated AdminNetworkPolicy, the
+	// others get the following priorities.
+	AdminNetworkPolicyPriority int64
+}
+
+// Generate returns a NetworkPolicy per Service named by the ComDetails of the matrix that selects pods
+// which are not on the host network, allowing ingress to the selected pods on exactly the matrix ports
+// of the Service. The client only resolves the Service selectors and pods, the ports come from the matrix.
+// The matrix has no namespaces, so a policy is generated for every Service of the name. Rows of protocols
+// NetworkPolicies do not support, such as ICMP or VRRP, are skipped.
+func Generate(c client.Client, m commatrix.ComMatrix, opts Options) ([]networkingv1.NetworkPolicy, error) {
+	if c == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = defaultPrefix
+	}
+
+	ports, err := matrixPorts(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		servicesList corev1.ServiceList
+		podsList     corev1.PodList
+	)
+	err = c.List(context.TODO(), &servicesList, &client.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	err = c.List(context.TODO(), &podsList, &client.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	namespaces := make(map[string]bool)
+	for _, ns := range opts.Namespaces {
+		namespaces[ns] = true
+	}
+
+	res := make([]networkingv1.NetworkPolicy, 0)
+	for _, service := range servicesList.Items {
+		if len(service.Spec.Selector) == 0 || len(ports[service.Name]) == 0 {
+			continue
+		}
+		if len(namespaces) > 0 && !namespaces[service.Namespace] {
+			continue
+		}
+		if !selectsPodNetworkPod(service, podsList.Items) {
+			continue
+		}
+
+		res = append(res, networkingv1.NetworkPolicy{
+			TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      opts.Prefix + service.Name,
+				Namespace: service.Namespace,
+				Labels:    map[string]string{GeneratedLabel: "true"},
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: service.Spec.Selector},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{Ports: ports[service.Name]}},
+			},
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Namespace != res[j].Namespace {
+			return res[i].Namespace < res[j].Namespace
+		}
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// matrixPorts returns the sorted TCP, UDP and SCTP ports of the matrix by service name.
+func matrixPorts(m commatrix.ComMatrix) (map[string][]networkingv1.NetworkPolicyPort, error) {
+	var (
+		res  = make(map[string][]networkingv1.NetworkPolicyPort)
+		seen = make(map[string]bool)
+	)
+	for _, cd := range m.Matrix {
+		protocol := corev1.Protocol(cd.Protocol)
+		if protocol != corev1.ProtocolTCP && protocol != corev1.ProtocolUDP && protocol != corev1.ProtocolSCTP {
+			continue
+		}
+
+		n, err := strconv.Atoi(cd.Port)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid ComDetails %s: invalid port %q", cd, cd.Port)
+		}
+
+		key := cd.ServiceName + "/" + cd.Protocol + "/" + cd.Port
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		port := intstr.FromInt32(int32(n))
+		res[cd.ServiceName] = append(res[cd.ServiceName], networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+
+	for _, ports := range res {
+		sort.Slice(ports, func(i, j int) bool {
+			if *ports[i].Protocol != *ports[j].Protocol {
+				return *ports[i].Protocol < *ports[j].Protocol
+			}
+			return ports[i].Port.IntValue() < ports[j].Port.IntValue()
+		})
+	}
+
+	return res, nil
+}
+
+// selectsPodNetworkPod returns whether the Service selects a pod which is not on the host network.
+func selectsPodNetworkPod(service corev1.Service, pods []corev1.Pod) bool {
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+	for _, pod := range pods {
+		if pod.Namespace != service.Namespace || pod.Spec.HostNetwork {
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ToAdminNetworkPolicies converts the policies to policy.networking.k8s.io/v1alpha1 AdminNetworkPolicies,
+// which cluster admins enforce regardless of the NetworkPolicies of the namespace owners. Every policy is
+// converted to an AdminNetworkPolicy allowing its ports from all namespaces and one denying any other ingress
+// to the selected pods. The allowing policies get consecutive priorities starting at AdminNetworkPolicyPriority,
+// followed by the denying policies, so pods selected by several Services are allowed the ports of all of them.
+func ToAdminNetworkPolicies(policies []networkingv1.NetworkPolicy, opts Options) ([]unstructured.Unstructured, error) {
+	last := opts.AdminNetworkPolicyPriority + int64(2*len(policies)) - 1
+	if opts.AdminNetworkPolicyPriority < 0 || last > maxAdminNetworkPolicyPriority {
+		return nil, fmt.Errorf("AdminNetworkPolicy priorities %d-%d are out of the range 0-%d",
+			opts.AdminNetworkPolicyPriority, last, maxAdminNetworkPolicyPriority)
+	}
+
+	var (
+		allows = make([]unstructured.Unstructured, 0, len(policies))
+		denies = make([]unstructured.Unstructured, 0, len(policies))
+	)
+	allNamespaces := []interface{}{map[string]interface{}{"namespaces": map[string]interface{}{}}}
+	for i, p := range policies {
+		ports := make([]interface{}, 0)
+		for _, rule := range p.Spec.Ingress {
+			for _, port := range rule.Ports {
+				ports = append(ports, map[string]interface{}{
+					"portNumber": map[string]interface{}{
+						"protocol": string(*port.Protocol),
+						"port":     int64(port.Port.IntValue()),
+					},
+				})
+			}
+		}
+
+		allow := adminNetworkPolicy(p, p.Namespace+"-"+p.Name+"-allow", opts.AdminNetworkPolicyPriority+int64(i),
+			map[string]interface{}{"name": "allow-matrix-ports", "action": "Allow", "from": allNamespaces, "ports": ports})
+		deny := adminNetworkPolicy(p, p.Namespace+"-"+p.Name+"-deny", opts.AdminNetworkPolicyPriority+int64(len(policies)+i),
+			map[string]interface{}{"name": "deny-other-ports", "action": "Deny", "from": allNamespaces})
+		allows = append(allows, allow)
+		denies = append(denies, deny)
+	}
+
+	return append(allows, denies...), nil
+}
+
+// adminNetworkPolicy returns an AdminNetworkPolicy with the ingress rule, whose subject is the pods selected by the policy.
+func adminNetworkPolicy(p networkingv1.NetworkPolicy, name string, priority int64, rule map[string]interface{}) unstructured.Unstructured {
+	matchLabels := make(map[string]interface{}, len(p.Spec.PodSelector.MatchLabels))
+	for k, v := range p.Spec.PodSelector.MatchLabels {
+		matchLabels[k] = v
+	}
+
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "policy.networking.k8s.io/v1alpha1",
+		"kind":       "AdminNetworkPolicy",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{GeneratedLabel: "true"},
+		},
+		"spec": map[string]interface{}{
+			"priority": priority,
+			"subject": map[string]interface{}{
+				"pods": map[string]interface{}{
+					"namespaceSelector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{"kubernetes.io/metadata.name": p.Namespace},
+					},
+					"podSelector": map[string]interface{}{"matchLabels": matchLabels},
+				},
+			},
+			"ingress": []interface{}{rule},
+		},
+	}}
+}
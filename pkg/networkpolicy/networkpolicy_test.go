@@ -0,0 +1,148 @@
+package networkpolicy
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/fakeclient"
+)
+
+var testMatrix = commatrix.ComMatrix{Matrix: []commatrix.ComDetails{
+	{Direction: "ingress", Protocol: "TCP", Port: "8443", NodeRole: "worker", ServiceName: "web", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "8080", NodeRole: "worker", ServiceName: "web", Required: true},
+	{Direction: "ingress", Protocol: "UDP", Port: "5353", NodeRole: "worker", ServiceName: "web", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "8443", NodeRole: "master", ServiceName: "web", Required: true},
+	{Direction: "ingress", Protocol: "VRRP", NodeRole: "worker", ServiceName: "web", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "9100", NodeRole: "worker", ServiceName: "agent", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "443", NodeRole: "worker", ServiceName: "external", Required: true},
+}}
+
+func testResources() fakeclient.ClusterResources {
+	pod := func(name string, app string, hostNetwork bool) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", Labels: map[string]string{"app": app}},
+			Spec:       corev1.PodSpec{HostNetwork: hostNetwork},
+		}
+	}
+	service := func(name string) corev1.Service {
+		return corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": name}},
+		}
+	}
+
+	return fakeclient.ClusterResources{
+		Pods: []corev1.Pod{pod("web-0", "web", false), pod("agent-0", "agent", true), pod("api-0", "api", false)},
+		Services: []corev1.Service{
+			service("web"),
+			service("agent"),
+			service("api"),
+			{ObjectMeta: metav1.ObjectMeta{Name: "external", Namespace: "apps"}},
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	c, err := fakeclient.New(fakeclient.ObjectsFromResources(testResources()))
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+
+	policies, err := Generate(c, testMatrix, Options{})
+	if err != nil {
+		t.Fatalf("failed to generate policies: %s", err)
+	}
+
+	if len(policies) != 1 {
+		t.Fatalf("got %d policies, expected 1: %v", len(policies), policies)
+	}
+
+	p := policies[0]
+	if p.Name != "commatrix-web" || p.Namespace != "apps" {
+		t.Fatalf("got policy %s/%s, expected apps/commatrix-web", p.Namespace, p.Name)
+	}
+
+	if !reflect.DeepEqual(p.Spec.PodSelector.MatchLabels, map[string]string{"app": "web"}) {
+		t.Fatalf("got pod selector %v, expected app=web", p.Spec.PodSelector.MatchLabels)
+	}
+
+	got := make([]string, 0)
+	for _, port := range p.Spec.Ingress[0].Ports {
+		got = append(got, string(*port.Protocol)+"/"+port.Port.String())
+	}
+	expected := []string{"TCP/8080", "TCP/8443", "UDP/5353"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got ports %v, expected %v", got, expected)
+	}
+
+	policies, err = Generate(c, testMatrix, Options{Namespaces: []string{"other"}})
+	if err != nil || len(policies) != 0 {
+		t.Fatalf("expected no policies outside the namespaces, got %v (err: %v)", policies, err)
+	}
+
+	invalid := commatrix.ComMatrix{Matrix: []commatrix.ComDetails{{Protocol: "TCP", Port: "0", ServiceName: "web"}}}
+	if _, err := Generate(c, invalid, Options{}); err == nil {
+		t.Fatalf("expected an error for an invalid port")
+	}
+}
+
+func TestToAdminNetworkPolicies(t *testing.T) {
+	c, err := fakeclient.New(fakeclient.ObjectsFromResources(testResources()))
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+
+	m := testMatrix
+	m.Matrix = append(append([]commatrix.ComDetails{}, m.Matrix...),
+		commatrix.ComDetails{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "worker", ServiceName: "api", Required: true})
+	policies, err := Generate(c, m, Options{})
+	if err != nil {
+		t.Fatalf("failed to generate policies: %s", err)
+	}
+
+	anps, err := ToAdminNetworkPolicies(policies, Options{AdminNetworkPolicyPriority: 30})
+	if err != nil {
+		t.Fatalf("failed to convert policies: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		priority int64
+		action   string
+		ports    int
+	}{
+		{name: "apps-commatrix-api-allow", priority: 30, action: "Allow", ports: 1},
+		{name: "apps-commatrix-web-allow", priority: 31, action: "Allow", ports: 3},
+		{name: "apps-commatrix-api-deny", priority: 32, action: "Deny"},
+		{name: "apps-commatrix-web-deny", priority: 33, action: "Deny"},
+	}
+	if len(anps) != len(tests) {
+		t.Fatalf("got %d AdminNetworkPolicies, expected %d: %v", len(anps), len(tests), anps)
+	}
+
+	for i, test := range tests {
+		anp := anps[i]
+		priority, _, _ := unstructured.NestedInt64(anp.Object, "spec", "priority")
+		ingress, _, _ := unstructured.NestedSlice(anp.Object, "spec", "ingress")
+		if anp.GetName() != test.name || priority != test.priority || len(ingress) != 1 {
+			t.Fatalf("test \"%s\" failed: got %s with priority %d and %d rules", test.name, anp.GetName(), priority, len(ingress))
+		}
+
+		rule := ingress[0].(map[string]interface{})
+		ports, _, _ := unstructured.NestedSlice(rule, "ports")
+		if rule["action"] != test.action || len(ports) != test.ports {
+			t.Fatalf("test \"%s\" failed: got action %v with %d ports", test.name, rule["action"], len(ports))
+		}
+	}
+
+	for _, priority := range []int64{-1, 998} {
+		if _, err := ToAdminNetworkPolicies(policies, Options{AdminNetworkPolicyPriority: priority}); err == nil {
+			t.Fatalf("expected an error for the priority %d", priority)
+		}
+	}
+}
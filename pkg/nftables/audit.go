@@ -0,0 +1,70 @@
+package nftables
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+)
+
+var (
+	logProtoRegex = regexp.MustCompile(`\bPROTO=(TCP|UDP)\b`)
+	logDPortRegex = regexp.MustCompile(`\bDPT=([0-9]+)\b`)
+)
+
+// ParseAuditCounters returns the ports counted by the audit sets of a ruleset generated in audit mode,
+// as listed by `nft list ruleset` or `nft -j list ruleset`, as a ComMatrix of the node role.
+func ParseAuditCounters(data []byte, nodeRole string) (commatrix.ComMatrix, error) {
+	tables, err := parseRuleset(data)
+	if err != nil {
+		return commatrix.ComMatrix{}, err
+	}
+
+	ports := make([]firewall.Port, 0)
+	for _, t := range tables {
+		for set, protocol := range map[string]string{AuditSetTCP: "tcp", AuditSetUDP: "udp"} {
+			counted, err := expandPorts(protocol, t.sets[set])
+			if err != nil {
+				return commatrix.ComMatrix{}, fmt.Errorf("set %s: %w", set, err)
+			}
+			for _, port := range counted {
+				ports = append(ports, firewall.Port{Protocol: strings.ToUpper(protocol), Port: port})
+			}
+		}
+	}
+
+	return portsMatrix(ports, nodeRole), nil
+}
+
+// ParseAuditLog returns the ports of the kernel log lines with the prefix, e.g. the output of
+// `journalctl -k`, as a ComMatrix of the node role. An empty prefix defaults to the audit log prefix.
+func ParseAuditLog(r io.Reader, nodeRole string, prefix string) (commatrix.ComMatrix, error) {
+	if prefix == "" {
+		prefix = defaultAuditLogPrefix
+	}
+
+	ports := make([]firewall.Port, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, prefix) {
+			continue
+		}
+
+		proto := logProtoRegex.FindStringSubmatch(line)
+		dport := logDPortRegex.FindStringSubmatch(line)
+		if proto == nil || dport == nil {
+			continue
+		}
+		ports = append(ports, firewall.Port{Protocol: proto[1], Port: dport[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return commatrix.ComMatrix{}, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return portsMatrix(ports, nodeRole), nil
+}
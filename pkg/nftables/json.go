@@ -0,0 +1,212 @@
+package nftables
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// jsonSchemaVersion is the libnftables JSON schema version of the generated rulesets.
+const jsonSchemaVersion = 1
+
+type jsonRuleset struct {
+	Nftables []map[string]interface{} `json:"nftables"`
+}
+
+type jsonTable struct {
+	Family string `json:"family"`
+	Name   string `json:"name"`
+}
+
+type jsonSet struct {
+	Family string        `json:"family"`
+	Table  string        `json:"table"`
+	Name   string        `json:"name"`
+	Type   string        `json:"type"`
+	Flags  []string      `json:"flags,omitempty"`
+	Elem   []interface{} `json:"elem,omitempty"`
+	Stmt   []interface{} `json:"stmt,omitempty"`
+}
+
+type jsonChain struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Hook   string `json:"hook"`
+	Prio   int    `json:"prio"`
+	Policy string `json:"policy"`
+}
+
+type jsonRule struct {
+	Family  string        `json:"family"`
+	Table   string        `json:"table"`
+	Chain   string        `json:"chain"`
+	Expr    []interface{} `json:"expr"`
+	Comment string        `json:"comment,omitempty"`
+}
+
+type jsonMatch struct {
+	Op    string      `json:"op"`
+	Left  interface{} `json:"left"`
+	Right interface{} `json:"right"`
+}
+
+// ToJSON returns the ruleset in the libnftables JSON format, as loaded by `nft -j -f`.
+func (r Ruleset) ToJSON() ([]byte, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []map[string]interface{}{
+		{"metainfo": map[string]int{"json_schema_version": jsonSchemaVersion}},
+	}
+	for _, t := range r.Tables {
+		objects = append(objects, map[string]interface{}{"table": jsonTable{Family: t.Family, Name: t.Name}})
+
+		for _, s := range t.Sets {
+			elem, err := jsonSetElements(s.Elements)
+			if err != nil {
+				return nil, fmt.Errorf("set %s: %w", s.Name, err)
+			}
+			objects = append(objects, map[string]interface{}{"set": jsonSet{
+				Family: t.Family,
+				Table:  t.Name,
+				Name:   s.Name,
+				Type:   s.Type,
+				Flags:  s.Flags,
+				Elem:   elem,
+				Stmt:   setStmt(s),
+			}})
+		}
+
+		for _, c := range t.Chains {
+			objects = append(objects, map[string]interface{}{"chain": jsonChain{
+				Family: t.Family,
+				Table:  t.Name,
+				Name:   c.Name,
+				Type:   c.Type,
+				Hook:   c.Hook,
+				Prio:   c.Priority,
+				Policy: c.Policy,
+			}})
+
+			for _, rule := range c.Rules {
+				expr, err := rule.jsonExpr()
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, map[string]interface{}{"rule": jsonRule{
+					Family:  t.Family,
+					Table:   t.Name,
+					Chain:   c.Name,
+					Expr:    expr,
+					Comment: rule.Comment,
+				}})
+			}
+		}
+	}
+
+	return json.Marshal(jsonRuleset{Nftables: objects})
+}
+
+func (r Rule) jsonExpr() ([]interface{}, error) {
+	expr := make([]interface{}, 0)
+	if r.Iifname != "" {
+		expr = append(expr, match("==", meta("iifname"), r.Iifname))
+	}
+	if len(r.CtState) > 0 {
+		expr = append(expr, match("in", map[string]interface{}{"ct": map[string]string{"key": "state"}}, r.CtState))
+	}
+	if r.L4Proto != "" {
+		expr = append(expr, match("==", meta("l4proto"), r.L4Proto))
+	}
+	if r.SaddrSet != "" {
+		expr = append(expr, match("==", payload(r.SaddrFamily, "saddr"), "@"+r.SaddrSet))
+	}
+	if len(r.DPorts) > 0 {
+		ports := make([]interface{}, 0, len(r.DPorts))
+		for _, p := range r.DPorts {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid port %q", r, p)
+			}
+			ports = append(ports, n)
+		}
+
+		var right interface{} = map[string]interface{}{"set": ports}
+		if len(ports) == 1 && !r.DPortSet {
+			right = ports[0]
+		}
+		op := "=="
+		if r.NegateDPorts {
+			op = "!="
+		}
+		expr = append(expr, match(op, payload(r.Protocol, "dport"), right))
+	}
+	if r.AddDPortToSet != "" {
+		expr = append(expr, map[string]interface{}{"set": map[string]interface{}{
+			"op":   "add",
+			"elem": payload(r.Protocol, "dport"),
+			"set":  "@" + r.AddDPortToSet,
+		}})
+	}
+	if r.LimitRate != "" {
+		rate, per, _ := strings.Cut(r.LimitRate, "/")
+		n, err := strconv.Atoi(rate)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid limit rate %q", r, r.LimitRate)
+		}
+		expr = append(expr, map[string]interface{}{"limit": map[string]interface{}{"rate": n, "per": per}})
+	}
+	if r.Counter {
+		expr = append(expr, map[string]interface{}{"counter": nil})
+	}
+	if r.LogPrefix != "" {
+		expr = append(expr, map[string]interface{}{"log": map[string]string{"prefix": r.LogPrefix}})
+	}
+	if r.Verdict != "" {
+		expr = append(expr, map[string]interface{}{r.Verdict: nil})
+	}
+
+	return expr, nil
+}
+
+func setStmt(s Set) []interface{} {
+	if !s.Counter {
+		return nil
+	}
+
+	return []interface{}{map[string]interface{}{"counter": nil}}
+}
+
+func match(op string, left interface{}, right interface{}) map[string]interface{} {
+	return map[string]interface{}{"match": jsonMatch{Op: op, Left: left, Right: right}}
+}
+
+func meta(key string) map[string]interface{} {
+	return map[string]interface{}{"meta": map[string]string{"key": key}}
+}
+
+func payload(protocol, field string) map[string]interface{} {
+	return map[string]interface{}{"payload": map[string]string{"protocol": protocol, "field": field}}
+}
+
+// jsonSetElements returns the CIDR elements as prefix expressions.
+func jsonSetElements(elements []string) ([]interface{}, error) {
+	res := make([]interface{}, 0, len(elements))
+	for _, e := range elements {
+		_, ipNet, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid element %q: %w", e, err)
+		}
+
+		ones, _ := ipNet.Mask.Size()
+		res = append(res, map[string]interface{}{"prefix": map[string]interface{}{"addr": ipNet.IP.String(), "len": ones}})
+	}
+
+	return res, nil
+}
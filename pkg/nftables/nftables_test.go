@@ -0,0 +1,542 @@
+package nftables
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var testComDetails = []commatrix.ComDetails{
+	{Direction: "ingress", Protocol: "TCP", Port: "6443", NodeRole: "master", ServiceName: "kubernetes", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "2379", NodeRole: "master", ServiceName: "etcd", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "master", ServiceName: "kubelet", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+	{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "worker", ServiceName: "ovn", Required: true},
+	{Direction: "ingress", Protocol: "TCP", Port: "9999", NodeRole: "worker", ServiceName: "custom", Required: true, NodeName: "worker-0"},
+}
+
+func TestGetRulesByRole(t *testing.T) {
+	rules, err := GetRulesByRole(testComDetails, Options{})
+	if err != nil {
+		t.Fatalf("failed to get rules by role: %s", err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("got %d rulesets, expected 2", len(rules))
+	}
+
+	if !strings.Contains(rules["master"], "6443") || !strings.Contains(rules["master"], "2379") {
+		t.Fatalf("master ruleset is missing control plane ports:\n%s", rules["master"])
+	}
+
+	if strings.Contains(rules["worker"], "6443") || strings.Contains(rules["worker"], "2379") {
+		t.Fatalf("worker ruleset contains control plane ports:\n%s", rules["worker"])
+	}
+}
+
+func TestGetRulesByNode(t *testing.T) {
+	rules, err := GetRulesByNode(testComDetails, Options{})
+	if err != nil {
+		t.Fatalf("failed to get rules by node: %s", err)
+	}
+
+	if len(rules) != 1 {
+		t.Fatalf("got %d rulesets, expected 1", len(rules))
+	}
+
+	for _, port := range []string{"10250", "6081", "9999"} {
+		if !strings.Contains(rules["worker-0"], port) {
+			t.Fatalf("worker-0 ruleset is missing port %s:\n%s", port, rules["worker-0"])
+		}
+	}
+}
+
+func TestWriteRulesToDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rules")
+
+	err := WriteRulesToDir(map[string]string{"master": "master rules", "worker": "worker rules"}, dir)
+	if err != nil {
+		t.Fatalf("failed to write rules: %s", err)
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "worker.nft"))
+	if err != nil || string(out) != "worker rules" {
+		t.Fatalf("got %q (err: %v), expected \"worker rules\"", out, err)
+	}
+
+	if err := WriteRulesToDir(map[string]string{"../escape": ""}, dir); err == nil {
+		t.Fatalf("expected error for ruleset name with a path")
+	}
+}
+
+func TestGetRulesWithSources(t *testing.T) {
+	sources := policy.Resolved{Rules: []policy.ResolvedRule{
+		{
+			Rule: policy.Rule{Name: "etcd", Protocol: "TCP", Ports: []string{"2379", "2380"}},
+			IPv4: []string{"10.0.0.1/32", "10.0.0.2/32"},
+		},
+	}}
+
+	rules, err := GetRules(testComDetails, Options{Sources: sources})
+	if err != nil {
+		t.Fatalf("failed to get rules: %s", err)
+	}
+
+	for _, expected := range []string{
+		"set etcd_v4 {",
+		"elements = { 10.0.0.1/32, 10.0.0.2/32,  };",
+		"ip saddr @etcd_v4 tcp dport { 2379,  } accept;",
+		"tcp dport { 6443, 10250, 9999,  } accept;",
+	} {
+		if !strings.Contains(rules, expected) {
+			t.Fatalf("ruleset is missing %q:\n%s", expected, rules)
+		}
+	}
+}
+
+func TestGetRulesOptions(t *testing.T) {
+	tests := []struct {
+		desc       string
+		opts       Options
+		contains   []string
+		notContain []string
+	}{
+		{
+			desc: "defaults",
+			opts: Options{},
+			contains: []string{
+				"table ip my_filter {",
+				"type filter hook input priority 0; policy drop;",
+				"iifname \"lo\" accept;",
+				"ct state established,related accept;",
+				"meta l4proto icmp accept;",
+				"tcp dport 22 accept;",
+			},
+			notContain: []string{"ipv6-icmp"},
+		},
+		{
+			desc: "inet-custom-names",
+			opts: Options{Family: "inet", Table: "commatrix", Chain: "nodes_input", Priority: -10, Policy: "accept"},
+			contains: []string{
+				"table inet commatrix {",
+				"chain nodes_input {",
+				"type filter hook input priority -10; policy accept;",
+				"meta l4proto icmp accept;",
+				"meta l4proto ipv6-icmp accept;",
+			},
+		},
+		{
+			desc:       "no-always-allowed-ports",
+			opts:       Options{AlwaysAllowedPorts: []firewall.Port{}, SkipEstablished: true, SkipLoopback: true, DropICMP: true},
+			notContain: []string{"dport 22 accept", "ct state", "iifname", "icmp"},
+		},
+	}
+
+	for _, test := range tests {
+		rules, err := GetRules(testComDetails, test.opts)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.desc, err)
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(rules, s) {
+				t.Fatalf("test \"%s\" failed: ruleset is missing %q:\n%s", test.desc, s, rules)
+			}
+		}
+		for _, s := range test.notContain {
+			if strings.Contains(rules, s) {
+				t.Fatalf("test \"%s\" failed: ruleset contains %q:\n%s", test.desc, s, rules)
+			}
+		}
+	}
+}
+
+func TestGetRulesInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Family: "bridge"},
+		{Policy: "reject"},
+		{Table: "my filter"},
+		{Chain: "input;"},
+		{LogDrops: true, Policy: "accept"},
+		{LogDrops: true, LogRate: "10/fortnight"},
+		{LogDrops: true, LogPrefix: "drop\" accept"},
+		{Audit: true, Policy: "drop"},
+	} {
+		if _, err := GetRules(testComDetails, opts); err == nil {
+			t.Fatalf("expected error for options %+v", opts)
+		}
+	}
+}
+
+func TestGetRulesGolden(t *testing.T) {
+	sources := policy.Resolved{Rules: []policy.ResolvedRule{
+		{
+			Rule: policy.Rule{Name: "etcd", Protocol: "TCP", Ports: []string{"2379", "2380"}},
+			IPv4: []string{"10.0.0.1/32", "10.0.0.2/32"},
+			IPv6: []string{"fd00::1/128"},
+		},
+		{
+			Rule: policy.Rule{Name: "kubelet", Protocol: "TCP", Ports: []string{"10250"}},
+			IPv4: []string{"10.0.0.0/16"},
+		},
+	}}
+
+	tests := []struct {
+		desc   string
+		golden string
+		opts   Options
+	}{
+		{
+			desc:   "defaults",
+			golden: "defaults.nft",
+			opts:   Options{},
+		},
+		{
+			desc:   "inet-sources",
+			golden: "inet-sources.nft",
+			opts:   Options{Family: "inet", Table: "commatrix", Sources: sources},
+		},
+		{
+			desc:   "rule-per-entry",
+			golden: "rule-per-entry.nft",
+			opts:   Options{Sources: sources, RulePerEntry: true, LogDrops: true},
+		},
+		{
+			desc:   "audit",
+			golden: "audit.nft",
+			opts:   Options{Audit: true},
+		},
+		{
+			desc:   "audit-sources",
+			golden: "audit-sources.nft",
+			opts:   Options{Audit: true, Sources: sources},
+		},
+	}
+
+	for _, test := range tests {
+		rules, err := GetRules(testComDetails, test.opts)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.desc, err)
+		}
+
+		compareGolden(t, test.golden, rules)
+	}
+}
+
+func TestGetRulesInvalidInput(t *testing.T) {
+	tests := []struct {
+		desc string
+		cd   commatrix.ComDetails
+	}{
+		{
+			desc: "non-numeric-port",
+			cd:   commatrix.ComDetails{Protocol: "TCP", Port: "22 } accept; tcp dport { 1"},
+		},
+		{
+			desc: "out-of-range-port",
+			cd:   commatrix.ComDetails{Protocol: "UDP", Port: "65536"},
+		},
+		{
+			desc: "injected-service-name",
+			cd:   commatrix.ComDetails{Protocol: "TCP", Port: "80", ServiceName: "web\"; accept; #"},
+		},
+		{
+			desc: "multiline-service-name",
+			cd:   commatrix.ComDetails{Protocol: "TCP", Port: "80", ServiceName: "web\n}"},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := GetRules([]commatrix.ComDetails{test.cd}, Options{}); err == nil {
+			t.Fatalf("test \"%s\" failed: expected error", test.desc)
+		}
+	}
+
+	invalidSources := policy.Resolved{Rules: []policy.ResolvedRule{
+		{Rule: policy.Rule{Name: "etcd"}, IPv4: []string{"10.0.0.1/32 } }"}},
+	}}
+	if _, err := GetRules(testComDetails, Options{Sources: invalidSources}); err == nil {
+		t.Fatalf("expected error for invalid source CIDR")
+	}
+}
+
+func compareGolden(t *testing.T, golden string, actual string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", golden)
+	if *update {
+		if err := os.WriteFile(path, []byte(actual), 0o644); err != nil {
+			t.Fatalf("failed to update golden file %s: %s", path, err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s: %s", path, err)
+	}
+
+	if string(expected) != actual {
+		t.Fatalf("output does not match golden file %s, run the tests with -update to regenerate it:\n%s", path, actual)
+	}
+}
+
+func TestGetRulesJSONGolden(t *testing.T) {
+	sources := policy.Resolved{Rules: []policy.ResolvedRule{
+		{
+			Rule: policy.Rule{Name: "etcd", Protocol: "TCP", Ports: []string{"2379", "2380"}},
+			IPv4: []string{"10.0.0.1/32", "10.1.0.0/16"},
+		},
+	}}
+
+	out, err := GetRulesJSON(testComDetails, Options{Sources: sources})
+	if err != nil {
+		t.Fatalf("failed to get JSON rules: %s", err)
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, out, "", "  "); err != nil {
+		t.Fatalf("generated invalid JSON: %s", err)
+	}
+
+	compareGolden(t, "sources.json", indented.String()+"\n")
+}
+
+func TestRulesetMerge(t *testing.T) {
+	master, err := BuildRuleset(testComDetails[:3], Options{})
+	if err != nil {
+		t.Fatalf("failed to build ruleset: %s", err)
+	}
+
+	extra := Ruleset{Tables: []Table{
+		{
+			Family: "ip",
+			Name:   "my_filter",
+			Sets:   []Set{{Name: "bgp_peers", Type: "ipv4_addr", Elements: []string{"192.168.0.1/32"}}},
+			Chains: []Chain{
+				{
+					Name: "input", Type: "filter", Hook: "input", Policy: "drop",
+					Rules: []Rule{{SaddrFamily: "ip", SaddrSet: "bgp_peers", Protocol: "tcp", DPorts: []string{"179"}, Verdict: "accept"}},
+				},
+			},
+		},
+		{Family: "inet", Name: "other"},
+	}}
+
+	merged, err := master.Merge(extra)
+	if err != nil {
+		t.Fatalf("failed to merge rulesets: %s", err)
+	}
+
+	if len(merged.Tables) != 2 {
+		t.Fatalf("got %d tables, expected 2", len(merged.Tables))
+	}
+
+	rules := merged.String()
+	for _, expected := range []string{"set bgp_peers {", "ip saddr @bgp_peers tcp dport 179 accept;", "table inet other {"} {
+		if !strings.Contains(rules, expected) {
+			t.Fatalf("merged ruleset is missing %q:\n%s", expected, rules)
+		}
+	}
+
+	invalid := Ruleset{Tables: []Table{{
+		Family: "ip",
+		Name:   "my_filter",
+		Chains: []Chain{{Name: "input", Type: "filter", Hook: "input", Policy: "drop", Rules: []Rule{{SaddrFamily: "ip", SaddrSet: "missing", Verdict: "accept"}}}},
+	}}}
+	if _, err := master.Merge(invalid); err == nil {
+		t.Fatalf("expected error for a rule referencing an undefined set")
+	}
+}
+
+func TestParseRuleset(t *testing.T) {
+	handWritten, err := os.ReadFile(filepath.Join("testdata", "hand-written.nft"))
+	if err != nil {
+		t.Fatalf("failed to read ruleset: %s", err)
+	}
+
+	generated, err := GetRules(testComDetails[:3], Options{})
+	if err != nil {
+		t.Fatalf("failed to get rules: %s", err)
+	}
+
+	generatedJSON, err := GetRulesJSON(testComDetails[:3], Options{})
+	if err != nil {
+		t.Fatalf("failed to get JSON rules: %s", err)
+	}
+
+	mapAfterSet := `table inet filter {
+	set web {
+		type inet_service
+		elements = { 80, 443 }
+	}
+
+	map vmap_ports {
+		type inet_service : verdict
+		elements = { 8443 : accept,
+			     9443 : accept }
+	}
+
+	counter dropped {
+		packets 0 bytes 0
+	}
+
+	chain input {
+		type filter hook input priority filter; policy drop;
+		tcp dport @web accept
+	}
+}
+`
+
+	tests := []struct {
+		desc     string
+		ruleset  []byte
+		expected []string
+	}{
+		{
+			desc:     "map after set",
+			ruleset:  []byte(mapAfterSet),
+			expected: []string{"TCP/80", "TCP/443"},
+		},
+		{
+			desc:     "hand written",
+			ruleset:  handWritten,
+			expected: []string{"TCP/22", "TCP/80", "TCP/443", "TCP/8080", "TCP/8081", "TCP/8082", "TCP/9000", "UDP/53", "UDP/123", "UDP/9000"},
+		},
+		{
+			desc:     "generated",
+			ruleset:  []byte(generated),
+			expected: []string{"TCP/22", "TCP/2379", "TCP/6443", "TCP/10250"},
+		},
+		{
+			desc:     "generated JSON",
+			ruleset:  generatedJSON,
+			expected: []string{"TCP/22", "TCP/2379", "TCP/6443", "TCP/10250"},
+		},
+	}
+
+	for _, test := range tests {
+		m, err := ParseRuleset(test.ruleset, "master")
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.desc, err)
+		}
+
+		got := make([]string, 0, len(m.Matrix))
+		for _, cd := range m.Matrix {
+			if cd.NodeRole != "master" {
+				t.Fatalf("test \"%s\" failed: got node role %q, expected master", test.desc, cd.NodeRole)
+			}
+			got = append(got, cd.Protocol+"/"+cd.Port)
+		}
+		if strings.Join(got, " ") != strings.Join(test.expected, " ") {
+			t.Fatalf("test \"%s\" failed: got ports %v, expected %v", test.desc, got, test.expected)
+		}
+	}
+}
+
+func TestExpandPorts(t *testing.T) {
+	tests := []struct {
+		desc     string
+		elements []string
+		ports    int
+		err      bool
+	}{
+		{desc: "port", elements: []string{"22 counter packets 1 bytes 60"}, ports: 1},
+		{desc: "range", elements: []string{"8080-8082"}, ports: 3},
+		{desc: "NodePort range", elements: []string{"30000-32767"}, ports: 2768},
+		{desc: "port zero", elements: []string{"0"}, err: true},
+		{desc: "range from port zero", elements: []string{"0-10"}, err: true},
+		{desc: "reversed range", elements: []string{"2000-1000"}, err: true},
+		{desc: "range of all the ports", elements: []string{"1-65535"}, err: true},
+	}
+
+	for _, test := range tests {
+		ports, err := expandPorts("tcp", test.elements)
+		if test.err {
+			if err == nil {
+				t.Fatalf("test \"%s\" failed: expected error, got ports %v", test.desc, ports)
+			}
+			continue
+		}
+		if err != nil || len(ports) != test.ports {
+			t.Fatalf("test \"%s\" failed: got %d ports, expected %d (err: %v)", test.desc, len(ports), test.ports, err)
+		}
+	}
+}
+
+func TestParseAudit(t *testing.T) {
+	listed := `table ip my_filter {
+	set commatrix_audit_tcp {
+		type inet_service
+		size 65535
+		flags dynamic
+		counter
+		elements = { 8080 counter packets 3 bytes 180,
+			     9090 counter packets 1 bytes 60 }
+	}
+
+	set commatrix_audit_udp {
+		type inet_service
+		size 65535
+		flags dynamic
+		counter
+		elements = { 5353 counter packets 7 bytes 420 }
+	}
+}
+`
+	listedJSON := `{"nftables": [
+		{"set": {"family": "ip", "table": "my_filter", "name": "commatrix_audit_tcp", "type": "inet_service", "flags": ["dynamic"],
+			"elem": [{"elem": {"val": 8080, "counter": {"packets": 3, "bytes": 180}}}, {"elem": {"val": 9090, "counter": {"packets": 1, "bytes": 60}}}]}},
+		{"set": {"family": "ip", "table": "my_filter", "name": "commatrix_audit_udp", "type": "inet_service", "flags": ["dynamic"],
+			"elem": [{"elem": {"val": 5353, "counter": {"packets": 7, "bytes": 420}}}]}}
+	]}`
+	log := `Oct 19 10:00:00 worker-0 kernel: commatrix-audit: IN=eth0 OUT= SRC=10.0.0.5 DST=10.0.0.10 PROTO=TCP SPT=51000 DPT=9090 SYN
+Oct 19 10:00:01 worker-0 kernel: commatrix-audit: IN=eth0 OUT= SRC=10.0.0.5 DST=10.0.0.10 PROTO=UDP SPT=5353 DPT=5353
+Oct 19 10:00:02 worker-0 kernel: other: IN=eth0 OUT= SRC=10.0.0.5 DST=10.0.0.10 PROTO=TCP SPT=51000 DPT=22 SYN
+Oct 19 10:00:03 worker-0 kernel: commatrix-audit: IN=eth0 OUT= SRC=10.0.0.5 DST=10.0.0.10 PROTO=TCP SPT=51001 DPT=9090 SYN`
+
+	tests := []struct {
+		desc     string
+		parse    func() (commatrix.ComMatrix, error)
+		expected []string
+	}{
+		{
+			desc:     "counters",
+			parse:    func() (commatrix.ComMatrix, error) { return ParseAuditCounters([]byte(listed), "worker") },
+			expected: []string{"TCP/8080", "TCP/9090", "UDP/5353"},
+		},
+		{
+			desc:     "JSON counters",
+			parse:    func() (commatrix.ComMatrix, error) { return ParseAuditCounters([]byte(listedJSON), "worker") },
+			expected: []string{"TCP/8080", "TCP/9090", "UDP/5353"},
+		},
+		{
+			desc:     "log",
+			parse:    func() (commatrix.ComMatrix, error) { return ParseAuditLog(strings.NewReader(log), "worker", "") },
+			expected: []string{"TCP/9090", "UDP/5353"},
+		},
+	}
+
+	for _, test := range tests {
+		m, err := test.parse()
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %s", test.desc, err)
+		}
+
+		got := make([]string, 0, len(m.Matrix))
+		for _, cd := range m.Matrix {
+			got = append(got, cd.Protocol+"/"+cd.Port)
+		}
+		if strings.Join(got, " ") != strings.Join(test.expected, " ") {
+			t.Fatalf("test \"%s\" failed: got ports %v, expected %v", test.desc, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package nftables
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+const (
+	defaultFamily = "ip"
+	defaultTable  = "my_filter"
+	defaultChain  = "input"
+	defaultPolicy = "drop"
+
+	defaultLogPrefix      = "commatrix-drop: "
+	defaultAuditLogPrefix = "commatrix-audit: "
+	defaultLogRate        = "10/minute"
+
+	// AuditSetTCP and AuditSetUDP are the sets counting the ports that are not accepted in audit mode.
+	AuditSetTCP = "commatrix_audit_tcp"
+	AuditSetUDP = "commatrix_audit_udp"
+)
+
+var identifierRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// Options controls the generated ruleset. The zero value is a safe configuration:
+// SSH, loopback, ICMP and the return traffic of tracked connections are accepted.
+type Options struct {
+	// Family is the table family: ip (default), ip6 or inet.
+	Family string
+	// Table is the table name, defaults to my_filter.
+	Table string
+	// Chain is the input chain name, defaults to input.
+	Chain string
+	// Priority is the priority of the input chain hook.
+	Priority int
+	// Policy is the default policy of the input chain: drop (default) or accept.
+	Policy string
+	// AlwaysAllowedPorts are accepted from any source regardless of the matrix.
+	// Nil defaults to SSH (TCP 22), an empty slice allows no additional port.
+	AlwaysAllowedPorts []firewall.Port
+	// SkipEstablished omits accepting the established and related connections.
+	SkipEstablished bool
+	// SkipLoopback omits accepting the traffic of the loopback interface.
+	SkipLoopback bool
+	// DropICMP omits accepting ICMP traffic.
+	DropICMP bool
+	// DropICMPv6 omits accepting ICMPv6 traffic, which IPv6 neighbor discovery relies on.
+	DropICMPv6 bool
+	// Sources restricts the source addresses of the ports matching its rules.
+	Sources policy.Resolved
+	// RulePerEntry emits a rule per ComDetails, with a counter and its service name as a comment,
+	// instead of collapsing the ports into anonymous sets.
+	RulePerEntry bool
+	// LogDrops adds a rate limited log rule at the end of the input chain, logging the packets
+	// that are dropped by its policy.
+	LogDrops bool
+	// LogPrefix is the prefix of the logged drops, defaults to "commatrix-drop: ".
+	LogPrefix string
+	// LogRate limits the logged drops, e.g. 10/minute (default).
+	LogRate string
+	// Audit accepts all the input traffic, and counts the ports of the packets that no rule accepts in
+	// the AuditSetTCP and AuditSetUDP sets and logs them with LogPrefix (defaults to "commatrix-audit: ")
+	// and LogRate, so the undocumented ports can be found before enforcing the ruleset. The matrix ports
+	// are never counted, even when the source of the packet is not allowed by Sources.
+	Audit bool
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Family == "" {
+		o.Family = defaultFamily
+	}
+	if o.Table == "" {
+		o.Table = defaultTable
+	}
+	if o.Chain == "" {
+		o.Chain = defaultChain
+	}
+	if o.Policy == "" && o.Audit {
+		o.Policy = "accept"
+	}
+	if o.Policy == "" {
+		o.Policy = defaultPolicy
+	}
+	if o.AlwaysAllowedPorts == nil {
+		o.AlwaysAllowedPorts = []firewall.Port{{Protocol: "TCP", Port: "22"}}
+	}
+	if o.Audit && o.LogPrefix == "" {
+		o.LogPrefix = defaultAuditLogPrefix
+	}
+	if o.LogDrops && o.LogPrefix == "" {
+		o.LogPrefix = defaultLogPrefix
+	}
+	if (o.LogDrops || o.Audit) && o.LogRate == "" {
+		o.LogRate = defaultLogRate
+	}
+
+	switch o.Family {
+	case "ip", "ip6", "inet":
+	default:
+		return o, fmt.Errorf("unsupported table family %q", o.Family)
+	}
+
+	if o.Policy != "drop" && o.Policy != "accept" {
+		return o, fmt.Errorf("unsupported chain policy %q", o.Policy)
+	}
+
+	if o.LogDrops && o.Policy != "drop" {
+		return o, fmt.Errorf("logging drops requires the drop chain policy")
+	}
+
+	if o.Audit && (o.Policy != "accept" || o.LogDrops) {
+		return o, fmt.Errorf("audit mode requires the accept chain policy")
+	}
+
+	if (o.LogDrops || o.Audit) && !limitRateRegex.MatchString(o.LogRate) {
+		return o, fmt.Errorf("invalid log rate %q", o.LogRate)
+	}
+
+	if !validText(o.LogPrefix) {
+		return o, fmt.Errorf("invalid log prefix %q", o.LogPrefix)
+	}
+
+	if !identifierRegex.MatchString(o.Table) {
+		return o, fmt.Errorf("invalid table name %q", o.Table)
+	}
+
+	if !identifierRegex.MatchString(o.Chain) {
+		return o, fmt.Errorf("invalid chain name %q", o.Chain)
+	}
+
+	if err := validateAlwaysAllowedPorts(o.AlwaysAllowedPorts); err != nil {
+		return o, err
+	}
+
+	if err := validateSources(o.Sources); err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+func (o Options) hasIPv4() bool {
+	return o.Family == "ip" || o.Family == "inet"
+}
+
+func (o Options) hasIPv6() bool {
+	return o.Family == "ip6" || o.Family == "inet"
+}
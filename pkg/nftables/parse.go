@@ -0,0 +1,527 @@
+package nftables
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+)
+
+// maxRangePorts is the maximum number of ports of a range expanded to ports, large enough for the
+// default NodePort range.
+const maxRangePorts = 4096
+
+var (
+	tableLineRegex  = regexp.MustCompile(`^table (\S+) (\S+) \{$`)
+	setLineRegex    = regexp.MustCompile(`^set (\S+) \{$`)
+	chainLineRegex  = regexp.MustCompile(`^chain (\S+) \{$`)
+	hookLineRegex   = regexp.MustCompile(`\bhook (\S+)\b`)
+	elementsRegex   = regexp.MustCompile(`^elements = \{(.*)`)
+	commentRegex    = regexp.MustCompile(`\s*comment ".*"$`)
+	dportRegex      = regexp.MustCompile(`\b(tcp|udp|sctp|th) dport (\{[^}]*\}|[^!\s]\S*)`)
+	l4protoRegex    = regexp.MustCompile(`\bmeta l4proto (\{[^}]*\}|\S+)`)
+	jumpRegex       = regexp.MustCompile(`\b(?:jump|goto) (\S+)$`)
+	serviceProtocol = map[string]bool{"tcp": true, "udp": true, "sctp": true}
+)
+
+// blockLineRegex matches the openers of the table blocks other than sets and chains, e.g. maps,
+// flowtables and named counters, whose contents are ignored.
+var blockLineRegex = regexp.MustCompile(`^(map|flowtable|counter|quota|limit|secmark|synproxy|ct helper|ct timeout|ct expectation) \S+ \{$`)
+
+// parsedTable is a table of a ruleset, reduced to what is needed to find the accepted input ports.
+type parsedTable struct {
+	// sets holds the raw elements of every set, e.g. "22" or "1000-2000".
+	sets   map[string][]string
+	chains map[string]*parsedChain
+}
+
+type parsedChain struct {
+	input bool
+	rules []parsedRule
+}
+
+type parsedRule struct {
+	protocols []string
+	// ports are raw elements, or a set reference starting with "@".
+	ports  []string
+	accept bool
+	jump   string
+}
+
+// ParseRuleset returns the input ports accepted by a ruleset, as listed by `nft list ruleset` or
+// `nft -j list ruleset`, as a ComMatrix of the node role. A port is accepted when a rule of a chain
+// attached to the input hook, or of a chain it jumps to, accepts it, regardless of the source
+// restrictions of the rule. The default policies of the chains are ignored.
+func ParseRuleset(data []byte, nodeRole string) (commatrix.ComMatrix, error) {
+	tables, err := parseRuleset(data)
+	if err != nil {
+		return commatrix.ComMatrix{}, err
+	}
+
+	ports := make([]firewall.Port, 0)
+	for _, t := range tables {
+		accepted, err := t.acceptedPorts()
+		if err != nil {
+			return commatrix.ComMatrix{}, err
+		}
+		ports = append(ports, accepted...)
+	}
+
+	return portsMatrix(ports, nodeRole), nil
+}
+
+// parseRuleset parses a ruleset in the text or the JSON format.
+func parseRuleset(data []byte) ([]*parsedTable, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		return parseJSONRuleset(data)
+	}
+
+	return parseTextRuleset(data)
+}
+
+// portsMatrix returns the ComMatrix of the node role accepting the ports, sorted by protocol and port.
+func portsMatrix(ports []firewall.Port, nodeRole string) commatrix.ComMatrix {
+	var (
+		cds  = make([]commatrix.ComDetails, 0)
+		seen = make(map[string]bool)
+	)
+	for _, p := range ports {
+		if seen[p.Protocol+"/"+p.Port] {
+			continue
+		}
+		seen[p.Protocol+"/"+p.Port] = true
+		cds = append(cds, commatrix.ComDetails{
+			Direction: "ingress",
+			Protocol:  p.Protocol,
+			Port:      p.Port,
+			NodeRole:  nodeRole,
+			Required:  true,
+		})
+	}
+
+	sort.Slice(cds, func(i, j int) bool {
+		if cds[i].Protocol != cds[j].Protocol {
+			return cds[i].Protocol < cds[j].Protocol
+		}
+		a, _ := strconv.Atoi(cds[i].Port)
+		b, _ := strconv.Atoi(cds[j].Port)
+		return a < b
+	})
+
+	return commatrix.ComMatrix{Matrix: cds}
+}
+
+func newParsedTable() *parsedTable {
+	return &parsedTable{sets: make(map[string][]string), chains: make(map[string]*parsedChain)}
+}
+
+// acceptedPorts returns the ports accepted by the input chains of the table and the chains they jump to.
+func (t *parsedTable) acceptedPorts() ([]firewall.Port, error) {
+	var (
+		res     = make([]firewall.Port, 0)
+		visited = make(map[string]bool)
+		pending = make([]string, 0)
+	)
+	for name, c := range t.chains {
+		if c.input {
+			pending = append(pending, name)
+		}
+	}
+	sort.Strings(pending)
+
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+
+		c, ok := t.chains[name]
+		if !ok {
+			continue
+		}
+		for _, r := range c.rules {
+			if r.jump != "" {
+				pending = append(pending, r.jump)
+				continue
+			}
+			if !r.accept || len(r.ports) == 0 {
+				continue
+			}
+
+			elements := make([]string, 0)
+			for _, p := range r.ports {
+				if strings.HasPrefix(p, "@") {
+					elements = append(elements, t.sets[strings.TrimPrefix(p, "@")]...)
+					continue
+				}
+				elements = append(elements, p)
+			}
+
+			for _, protocol := range r.protocols {
+				ports, err := expandPorts(protocol, elements)
+				if err != nil {
+					return nil, err
+				}
+				for _, port := range ports {
+					res = append(res, firewall.Port{Protocol: strings.ToUpper(protocol), Port: port})
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// expandPorts returns the ports of the elements, expanding ranges and resolving service names.
+// The statements of the elements, e.g. their counters, are ignored. Ranges of more than
+// maxRangePorts ports are rejected rather than expanded to a row per port.
+func expandPorts(protocol string, elements []string) ([]string, error) {
+	res := make([]string, 0)
+	for _, e := range elements {
+		fields := strings.Fields(e)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Service names may contain dashes, e.g. netbios-ssn, so the element is a range only
+		// when it is not a port or a service name as a whole.
+		port, err := portNumber(protocol, fields[0])
+		if err == nil {
+			res = append(res, strconv.Itoa(port))
+			continue
+		}
+
+		first, last, isRange := strings.Cut(fields[0], "-")
+		if !isRange {
+			return nil, err
+		}
+
+		from, err := portNumber(protocol, first)
+		if err != nil {
+			return nil, err
+		}
+		to, err := portNumber(protocol, last)
+		if err != nil {
+			return nil, err
+		}
+		if from > to || to-from >= maxRangePorts {
+			return nil, fmt.Errorf("unsupported port range %q: ranges of up to %d ports are supported", fields[0], maxRangePorts)
+		}
+
+		for port := from; port <= to; port++ {
+			res = append(res, strconv.Itoa(port))
+		}
+	}
+
+	return res, nil
+}
+
+func portNumber(protocol string, s string) (int, error) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 65535 {
+			return 0, fmt.Errorf("invalid port %q", s)
+		}
+		return n, nil
+	}
+
+	n, err := net.LookupPort(protocol, s)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse port %q: %w", s, err)
+	}
+
+	return n, nil
+}
+
+func parseTextRuleset(data []byte) ([]*parsedTable, error) {
+	var (
+		tables   = make([]*parsedTable, 0)
+		table    *parsedTable
+		chain    *parsedChain
+		set      string
+		elements *string
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// Rulesets written for `nft -f` may terminate statements with semicolons.
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ";")
+
+		// Set elements may span multiple lines until the closing brace.
+		if elements != nil {
+			*elements += " " + line
+			if strings.Contains(line, "}") {
+				table.sets[set] = splitElements(*elements)
+				elements = nil
+			}
+			continue
+		}
+
+		if m := tableLineRegex.FindStringSubmatch(line); m != nil {
+			table = newParsedTable()
+			tables = append(tables, table)
+			chain, set = nil, ""
+			continue
+		}
+		if table == nil {
+			continue
+		}
+
+		if m := setLineRegex.FindStringSubmatch(line); m != nil {
+			set, chain = m[1], nil
+			continue
+		}
+		if m := chainLineRegex.FindStringSubmatch(line); m != nil {
+			chain = &parsedChain{}
+			table.chains[m[1]] = chain
+			set = ""
+			continue
+		}
+		if blockLineRegex.MatchString(line) {
+			set, chain = "", nil
+			continue
+		}
+
+		if set != "" {
+			if m := elementsRegex.FindStringSubmatch(line); m != nil {
+				if strings.Contains(m[1], "}") {
+					table.sets[set] = splitElements(m[1])
+					continue
+				}
+				joined := m[1]
+				elements = &joined
+			}
+			continue
+		}
+
+		if chain == nil {
+			continue
+		}
+		if strings.HasPrefix(line, "type ") {
+			if m := hookLineRegex.FindStringSubmatch(line); m != nil && m[1] == "input" {
+				chain.input = true
+			}
+			continue
+		}
+		if rule, ok := parseTextRule(line); ok {
+			chain.rules = append(chain.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ruleset: %w", err)
+	}
+
+	return tables, nil
+}
+
+func parseTextRule(line string) (parsedRule, bool) {
+	line = commentRegex.ReplaceAllString(line, "")
+
+	if m := jumpRegex.FindStringSubmatch(line); m != nil {
+		return parsedRule{jump: m[1]}, true
+	}
+
+	m := dportRegex.FindStringSubmatch(line)
+	if m == nil {
+		return parsedRule{}, false
+	}
+
+	rule := parsedRule{accept: strings.HasSuffix(line, " accept")}
+	if m[1] == "th" {
+		if l4 := l4protoRegex.FindStringSubmatch(line); l4 != nil {
+			for _, p := range splitElements(l4[1]) {
+				if serviceProtocol[p] {
+					rule.protocols = append(rule.protocols, p)
+				}
+			}
+		}
+	} else {
+		rule.protocols = []string{m[1]}
+	}
+
+	if strings.HasPrefix(m[2], "@") {
+		rule.ports = []string{m[2]}
+	} else {
+		rule.ports = splitElements(m[2])
+	}
+
+	return rule, true
+}
+
+// splitElements splits a set expression such as "{ 22, 80 }" into its elements.
+func splitElements(s string) []string {
+	s = strings.NewReplacer("{", "", "}", "").Replace(s)
+
+	res := make([]string, 0)
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+func parseJSONRuleset(data []byte) ([]*parsedTable, error) {
+	var ruleset jsonRuleset
+	err := json.Unmarshal(data, &ruleset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON ruleset: %w", err)
+	}
+
+	var (
+		tables = make([]*parsedTable, 0)
+		byName = make(map[string]*parsedTable)
+	)
+	tableOf := func(family, name string) *parsedTable {
+		key := family + "/" + name
+		if t, ok := byName[key]; ok {
+			return t
+		}
+		t := newParsedTable()
+		byName[key] = t
+		tables = append(tables, t)
+		return t
+	}
+	chainOf := func(t *parsedTable, name string) *parsedChain {
+		if c, ok := t.chains[name]; ok {
+			return c
+		}
+		c := &parsedChain{}
+		t.chains[name] = c
+		return c
+	}
+
+	for _, obj := range ruleset.Nftables {
+		for kind, raw := range obj {
+			content, err := json.Marshal(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse JSON ruleset: %w", err)
+			}
+
+			switch kind {
+			case "set":
+				var s jsonSet
+				if err := json.Unmarshal(content, &s); err != nil {
+					return nil, fmt.Errorf("failed to parse JSON set: %w", err)
+				}
+				t := tableOf(s.Family, s.Table)
+				for _, e := range s.Elem {
+					t.sets[s.Name] = append(t.sets[s.Name], jsonElements(e)...)
+				}
+			case "chain":
+				var c jsonChain
+				if err := json.Unmarshal(content, &c); err != nil {
+					return nil, fmt.Errorf("failed to parse JSON chain: %w", err)
+				}
+				if c.Hook == "input" {
+					chainOf(tableOf(c.Family, c.Table), c.Name).input = true
+				}
+			case "rule":
+				var r jsonRule
+				if err := json.Unmarshal(content, &r); err != nil {
+					return nil, fmt.Errorf("failed to parse JSON rule: %w", err)
+				}
+				c := chainOf(tableOf(r.Family, r.Table), r.Chain)
+				c.rules = append(c.rules, parseJSONRule(r.Expr))
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+func parseJSONRule(exprs []interface{}) parsedRule {
+	var (
+		rule    parsedRule
+		l4proto []string
+	)
+	for _, e := range exprs {
+		expr, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if _, ok := expr["accept"]; ok {
+			rule.accept = true
+		}
+		for _, verdict := range []string{"jump", "goto"} {
+			if target, ok := expr[verdict].(map[string]interface{}); ok {
+				rule.jump, _ = target["target"].(string)
+			}
+		}
+
+		match, ok := expr["match"].(map[string]interface{})
+		if !ok || (match["op"] != "==" && match["op"] != "in") {
+			continue
+		}
+		left, _ := match["left"].(map[string]interface{})
+		if meta, ok := left["meta"].(map[string]interface{}); ok && meta["key"] == "l4proto" {
+			l4proto = jsonElements(match["right"])
+			continue
+		}
+
+		payload, ok := left["payload"].(map[string]interface{})
+		if !ok || payload["field"] != "dport" {
+			continue
+		}
+		protocol, _ := payload["protocol"].(string)
+		if protocol == "th" {
+			for _, p := range l4proto {
+				if serviceProtocol[p] {
+					rule.protocols = append(rule.protocols, p)
+				}
+			}
+		} else if serviceProtocol[protocol] {
+			rule.protocols = []string{protocol}
+		}
+		rule.ports = jsonElements(match["right"])
+	}
+
+	return rule
+}
+
+// jsonElements returns the raw elements of a JSON expression: a value, a set reference, an anonymous set or a range.
+func jsonElements(v interface{}) []string {
+	switch value := v.(type) {
+	case float64:
+		return []string{strconv.Itoa(int(value))}
+	case string:
+		return []string{value}
+	case []interface{}:
+		res := make([]string, 0)
+		for _, item := range value {
+			res = append(res, jsonElements(item)...)
+		}
+		return res
+	case map[string]interface{}:
+		if set, ok := value["set"]; ok {
+			return jsonElements(set)
+		}
+		if r, ok := value["range"].([]interface{}); ok && len(r) == 2 {
+			from, to := jsonElements(r[0]), jsonElements(r[1])
+			if len(from) == 1 && len(to) == 1 {
+				return []string{from[0] + "-" + to[0]}
+			}
+		}
+		if elem, ok := value["elem"]; ok {
+			return jsonElements(elem)
+		}
+		if val, ok := value["val"]; ok {
+			return jsonElements(val)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package nftables
+
+import (
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+)
+
+// GetRulesByRole returns a ruleset per node role, each allowing only the ports of that role that are not
+// bound to any node. It fails if a ComDetails has no node role.
+func GetRulesByRole(cds []commatrix.ComDetails, opts Options) (map[string]string, error) {
+	return firewall.RulesByRole(cds, renderer(opts))
+}
+
+// GetRulesByNode returns a ruleset per node that has ComDetails with its NodeName set.
+// The ruleset of a node allows its own ports and the ports of its role that are not bound to any node.
+func GetRulesByNode(cds []commatrix.ComDetails, opts Options) (map[string]string, error) {
+	return firewall.RulesByNode(cds, renderer(opts))
+}
+
+// WriteRulesToDir writes every ruleset to a "<name>.nft" file in dir, creating dir if needed.
+func WriteRulesToDir(rules map[string]string, dir string) error {
+	return firewall.WriteRulesToDir(rules, dir, ".nft")
+}
+
+func renderer(opts Options) firewall.Renderer {
+	return func(cds []commatrix.ComDetails) (string, error) {
+		return GetRules(cds, opts)
+	}
+}
@@ -0,0 +1,506 @@
+package nftables
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+// Ruleset is an in-memory nftables ruleset.
+type Ruleset struct {
+	Tables []Table
+}
+
+type Table struct {
+	Family string
+	Name   string
+	Sets   []Set
+	Chains []Chain
+}
+
+// Set is a named set of addresses or ports.
+type Set struct {
+	Name     string
+	Type     string
+	Flags    []string
+	Elements []string
+	// Counter counts the packets and bytes of every element.
+	Counter bool
+}
+
+// Chain is a base chain attached to a netfilter hook.
+type Chain struct {
+	Name     string
+	Type     string
+	Hook     string
+	Priority int
+	Policy   string
+	Rules    []Rule
+}
+
+// Rule matches packets by all of its set fields and applies its verdict.
+type Rule struct {
+	// Iifname matches the input interface name.
+	Iifname string
+	// CtState matches the connection tracking states.
+	CtState []string
+	// L4Proto matches the layer 4 protocol, e.g. icmp.
+	L4Proto string
+	// SaddrFamily (ip or ip6) and SaddrSet match the source address against a named set.
+	SaddrFamily string
+	SaddrSet    string
+	// Protocol (tcp or udp) and DPorts match the destination port. Unless DPortSet is set,
+	// a single port is matched directly rather than through an anonymous set.
+	Protocol string
+	DPorts   []string
+	DPortSet bool
+	// NegateDPorts matches the destination ports that are not in DPorts instead.
+	NegateDPorts bool
+	// LimitRate limits the rate of the matched packets, e.g. 10/minute.
+	LimitRate string
+	// AddDPortToSet adds the Protocol destination port of the matched packets to the named set.
+	AddDPortToSet string
+	// Counter counts the matched packets and bytes.
+	Counter bool
+	// LogPrefix logs the matched packets with the prefix.
+	LogPrefix string
+	// Verdict is accept or drop, and may be empty for log rules.
+	Verdict string
+	// Comment is shown when listing the ruleset, e.g. the service of the rule ports.
+	Comment string
+}
+
+const rulesetTemplate = `#!/usr/sbin/nft -f
+{{range .Tables}}
+table {{.Family}} {{.Name}} {
+{{- range .Sets}}
+    set {{.Name}} {
+        type {{.Type}};{{if .Flags}} flags {{join .Flags ", "}};{{end}}{{if .Counter}} counter;{{end}}
+{{- if gt (len .Elements) 0}}
+        elements = { {{range .Elements}}{{.}}, {{end}} };
+{{- end}}
+    }
+{{- end}}
+{{- range .Chains}}
+    chain {{.Name}} {
+        type {{.Type}} hook {{.Hook}} priority {{.Priority}}; policy {{.Policy}};
+{{range .Rules}}
+        {{.}};
+{{- end}}
+    }
+{{- end}}
+}
+{{end -}}
+`
+
+var rulesetTmpl = template.Must(template.New("rulesetTemplate").
+	Funcs(template.FuncMap{"join": strings.Join}).
+	Parse(rulesetTemplate))
+
+// BuildRuleset returns the ruleset allowing the ports of the ComDetails.
+func BuildRuleset(cds []commatrix.ComDetails, opts Options) (Ruleset, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return Ruleset{}, err
+	}
+
+	err = validateComDetails(cds)
+	if err != nil {
+		return Ruleset{}, err
+	}
+
+	table := Table{
+		Family: opts.Family,
+		Name:   opts.Table,
+		Sets:   make([]Set, 0),
+	}
+	chain := Chain{
+		Name:     opts.Chain,
+		Type:     "filter",
+		Hook:     "input",
+		Priority: opts.Priority,
+		Policy:   opts.Policy,
+		Rules:    baseRules(opts),
+	}
+
+	var (
+		tcpPorts    = make([]string, 0)
+		udpPorts    = make([]string, 0)
+		sourceRules = make([]Rule, 0)
+		entryRules  = make([]Rule, 0)
+		seen        = make(map[string]bool)
+		sets        = make(map[string]bool)
+		sourceIdx   = make(map[string]int)
+		documented  = make(map[string][]string)
+	)
+	for _, cd := range cds {
+		key := cd.Protocol + "/" + cd.Port
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if cd.Protocol != "TCP" && cd.Protocol != "UDP" {
+			continue
+		}
+		documented[cd.Protocol] = append(documented[cd.Protocol], cd.Port)
+
+		rule, ok := opts.Sources.Match(cd)
+		if !ok && opts.RulePerEntry {
+			entryRules = append(entryRules, entryRule(cd, "", ""))
+			continue
+		}
+		if !ok {
+			if cd.Protocol == "TCP" {
+				tcpPorts = append(tcpPorts, cd.Port)
+			} else {
+				udpPorts = append(udpPorts, cd.Port)
+			}
+			continue
+		}
+
+		for _, set := range sourceSets(rule, opts) {
+			if !sets[set.Name] {
+				sets[set.Name] = true
+				table.Sets = append(table.Sets, set)
+			}
+
+			if opts.RulePerEntry {
+				sourceRules = append(sourceRules, entryRule(cd, addressFamily(set.Type), set.Name))
+				continue
+			}
+
+			ruleKey := set.Name + "/" + cd.Protocol
+			idx, ok := sourceIdx[ruleKey]
+			if !ok {
+				idx = len(sourceRules)
+				sourceIdx[ruleKey] = idx
+				sourceRules = append(sourceRules, Rule{
+					SaddrFamily: addressFamily(set.Type),
+					SaddrSet:    set.Name,
+					Protocol:    strings.ToLower(cd.Protocol),
+					DPortSet:    true,
+					Verdict:     "accept",
+				})
+			}
+			sourceRules[idx].DPorts = append(sourceRules[idx].DPorts, cd.Port)
+		}
+	}
+
+	if len(tcpPorts) > 0 {
+		chain.Rules = append(chain.Rules, Rule{Protocol: "tcp", DPorts: tcpPorts, DPortSet: true, Verdict: "accept"})
+	}
+	if len(udpPorts) > 0 {
+		chain.Rules = append(chain.Rules, Rule{Protocol: "udp", DPorts: udpPorts, DPortSet: true, Verdict: "accept"})
+	}
+	chain.Rules = append(chain.Rules, entryRules...)
+	chain.Rules = append(chain.Rules, sourceRules...)
+	if opts.LogDrops {
+		chain.Rules = append(chain.Rules, Rule{LimitRate: opts.LogRate, LogPrefix: opts.LogPrefix})
+	}
+	if opts.Audit {
+		table.Sets = append(table.Sets, auditSets()...)
+		chain.Rules = append(chain.Rules, auditRules(opts, documented)...)
+	}
+
+	table.Chains = []Chain{chain}
+
+	return Ruleset{Tables: []Table{table}}, nil
+}
+
+// baseRules returns the rules accepting the traffic that is allowed regardless of the matrix.
+func baseRules(opts Options) []Rule {
+	res := make([]Rule, 0)
+	if !opts.SkipLoopback {
+		res = append(res, Rule{Iifname: "lo", Verdict: "accept"})
+	}
+	if !opts.SkipEstablished {
+		res = append(res, Rule{CtState: []string{"established", "related"}, Verdict: "accept"})
+	}
+	if !opts.DropICMP && opts.hasIPv4() {
+		res = append(res, Rule{L4Proto: "icmp", Verdict: "accept"})
+	}
+	if !opts.DropICMPv6 && opts.hasIPv6() {
+		res = append(res, Rule{L4Proto: "ipv6-icmp", Verdict: "accept"})
+	}
+	for _, p := range opts.AlwaysAllowedPorts {
+		res = append(res, Rule{Protocol: strings.ToLower(p.Protocol), DPorts: []string{p.Port}, Verdict: "accept"})
+	}
+
+	return res
+}
+
+// auditSets returns the sets counting the packets of every port that no rule accepts.
+func auditSets() []Set {
+	return []Set{
+		{Name: AuditSetTCP, Type: "inet_service", Flags: []string{"dynamic"}, Counter: true},
+		{Name: AuditSetUDP, Type: "inet_service", Flags: []string{"dynamic"}, Counter: true},
+	}
+}
+
+// auditRules returns the rules counting and logging the packets that no rule accepts, before the accept
+// policy of the audit mode accepts them. The packets to the documented ports, by protocol, reach the audit
+// rules only when their source is not allowed, so they are neither counted nor logged as undocumented ports.
+func auditRules(opts Options, documented map[string][]string) []Rule {
+	res := make([]Rule, 0, 2)
+	for _, p := range []struct{ protocol, set string }{{"TCP", AuditSetTCP}, {"UDP", AuditSetUDP}} {
+		rule := Rule{AddDPortToSet: p.set, LimitRate: opts.LogRate, LogPrefix: opts.LogPrefix}
+		rule.Protocol = strings.ToLower(p.protocol)
+		if ports := documented[p.protocol]; len(ports) > 0 {
+			rule.DPorts, rule.DPortSet, rule.NegateDPorts = ports, true, true
+		} else {
+			rule.L4Proto = rule.Protocol
+		}
+		res = append(res, rule)
+	}
+
+	return res
+}
+
+// entryRule returns the commented rule accepting the port of the ComDetails, from the set when it is not empty.
+func entryRule(cd commatrix.ComDetails, saddrFamily string, saddrSet string) Rule {
+	return Rule{
+		SaddrFamily: saddrFamily,
+		SaddrSet:    saddrSet,
+		Protocol:    strings.ToLower(cd.Protocol),
+		DPorts:      []string{cd.Port},
+		Counter:     true,
+		Verdict:     "accept",
+		Comment:     cd.ServiceName,
+	}
+}
+
+// sourceSets returns the sets of the rule addresses of every family of the table.
+func sourceSets(rule policy.ResolvedRule, opts Options) []Set {
+	res := make([]Set, 0, 2)
+	if opts.hasIPv4() {
+		res = append(res, Set{Name: rule.Name + "_v4", Type: "ipv4_addr", Flags: []string{"interval"}, Elements: rule.IPv4})
+	}
+	if opts.hasIPv6() {
+		res = append(res, Set{Name: rule.Name + "_v6", Type: "ipv6_addr", Flags: []string{"interval"}, Elements: rule.IPv6})
+	}
+
+	return res
+}
+
+func addressFamily(setType string) string {
+	if setType == "ipv6_addr" {
+		return "ip6"
+	}
+
+	return "ip"
+}
+
+// String returns the rule statement in the nft syntax, without the trailing semicolon.
+func (r Rule) String() string {
+	parts := make([]string, 0)
+	if r.Iifname != "" {
+		parts = append(parts, fmt.Sprintf("iifname %q", r.Iifname))
+	}
+	if len(r.CtState) > 0 {
+		parts = append(parts, "ct state "+strings.Join(r.CtState, ","))
+	}
+	if r.L4Proto != "" {
+		parts = append(parts, "meta l4proto "+r.L4Proto)
+	}
+	if r.SaddrSet != "" {
+		parts = append(parts, fmt.Sprintf("%s saddr @%s", r.SaddrFamily, r.SaddrSet))
+	}
+	if len(r.DPorts) > 0 {
+		op := ""
+		if r.NegateDPorts {
+			op = "!= "
+		}
+		if len(r.DPorts) == 1 && !r.DPortSet {
+			parts = append(parts, fmt.Sprintf("%s dport %s%s", r.Protocol, op, r.DPorts[0]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s dport %s{ %s,  }", r.Protocol, op, strings.Join(r.DPorts, ", ")))
+		}
+	}
+	if r.AddDPortToSet != "" {
+		parts = append(parts, fmt.Sprintf("add @%s { %s dport }", r.AddDPortToSet, r.Protocol))
+	}
+	if r.LimitRate != "" {
+		parts = append(parts, "limit rate "+r.LimitRate)
+	}
+	if r.Counter {
+		parts = append(parts, "counter")
+	}
+	if r.LogPrefix != "" {
+		parts = append(parts, fmt.Sprintf("log prefix %q", r.LogPrefix))
+	}
+	if r.Verdict != "" {
+		parts = append(parts, r.Verdict)
+	}
+	if r.Comment != "" {
+		parts = append(parts, fmt.Sprintf("comment %q", r.Comment))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// String returns the ruleset in the nft syntax, as loaded by `nft -f`.
+func (r Ruleset) String() string {
+	var out bytes.Buffer
+
+	// The template only accesses fields and String methods, so executing it cannot fail.
+	_ = rulesetTmpl.Execute(&out, r)
+
+	return out.String()
+}
+
+// Merge returns a ruleset with the tables of both rulesets. Tables of the same family and name
+// are merged: sets are added unless a set with the same name exists, and the rules of chains
+// with the same name are appended.
+func (r Ruleset) Merge(other Ruleset) (Ruleset, error) {
+	res := Ruleset{Tables: make([]Table, 0, len(r.Tables)+len(other.Tables))}
+	tableIdx := make(map[string]int)
+
+	for _, t := range append(append([]Table{}, r.Tables...), other.Tables...) {
+		key := t.Family + "/" + t.Name
+		idx, ok := tableIdx[key]
+		if !ok {
+			tableIdx[key] = len(res.Tables)
+			res.Tables = append(res.Tables, Table{
+				Family: t.Family,
+				Name:   t.Name,
+				Sets:   append([]Set{}, t.Sets...),
+				Chains: append([]Chain{}, t.Chains...),
+			})
+			continue
+		}
+
+		merged, err := mergeTables(res.Tables[idx], t)
+		if err != nil {
+			return Ruleset{}, err
+		}
+		res.Tables[idx] = merged
+	}
+
+	return res, res.Validate()
+}
+
+func mergeTables(t Table, other Table) (Table, error) {
+	for _, set := range other.Sets {
+		existing, ok := t.set(set.Name)
+		if !ok {
+			t.Sets = append(t.Sets, set)
+			continue
+		}
+		if existing.Type != set.Type {
+			return Table{}, fmt.Errorf("table %s %s: set %s is defined with types %s and %s", t.Family, t.Name, set.Name, existing.Type, set.Type)
+		}
+	}
+
+	for _, chain := range other.Chains {
+		idx := -1
+		for i := range t.Chains {
+			if t.Chains[i].Name == chain.Name {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			t.Chains = append(t.Chains, chain)
+			continue
+		}
+
+		existing := t.Chains[idx]
+		if existing.Hook != chain.Hook || existing.Policy != chain.Policy || existing.Priority != chain.Priority {
+			return Table{}, fmt.Errorf("table %s %s: chain %s is defined with different hooks", t.Family, t.Name, chain.Name)
+		}
+		existing.Rules = append(append([]Rule{}, existing.Rules...), chain.Rules...)
+		t.Chains[idx] = existing
+	}
+
+	return t, nil
+}
+
+func (t Table) set(name string) (Set, bool) {
+	for _, s := range t.Sets {
+		if s.Name == name {
+			return s, true
+		}
+	}
+
+	return Set{}, false
+}
+
+// Validate checks the names, the set references and the ports of the ruleset.
+func (r Ruleset) Validate() error {
+	for _, t := range r.Tables {
+		switch t.Family {
+		case "ip", "ip6", "inet":
+		default:
+			return fmt.Errorf("table %s: unsupported family %q", t.Name, t.Family)
+		}
+		if !identifierRegex.MatchString(t.Name) {
+			return fmt.Errorf("invalid table name %q", t.Name)
+		}
+
+		for _, s := range t.Sets {
+			if !identifierRegex.MatchString(s.Name) {
+				return fmt.Errorf("table %s: invalid set name %q", t.Name, s.Name)
+			}
+		}
+
+		for _, c := range t.Chains {
+			if !identifierRegex.MatchString(c.Name) {
+				return fmt.Errorf("table %s: invalid chain name %q", t.Name, c.Name)
+			}
+			for _, rule := range c.Rules {
+				if err := t.validateRule(rule); err != nil {
+					return fmt.Errorf("table %s chain %s: %w", t.Name, c.Name, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t Table) validateRule(rule Rule) error {
+	if rule.Iifname != "" && !interfaceNameRegex.MatchString(rule.Iifname) {
+		return fmt.Errorf("rule %q: invalid interface name %q", rule, rule.Iifname)
+	}
+
+	for _, name := range []string{rule.SaddrSet, rule.AddDPortToSet} {
+		if name == "" {
+			continue
+		}
+		if _, ok := t.set(name); !ok {
+			return fmt.Errorf("rule %q references undefined set %s", rule, name)
+		}
+	}
+
+	for _, port := range rule.DPorts {
+		if err := firewall.ValidatePort(port); err != nil {
+			return fmt.Errorf("rule %q: %w", rule, err)
+		}
+	}
+
+	if rule.LimitRate != "" && !limitRateRegex.MatchString(rule.LimitRate) {
+		return fmt.Errorf("rule %q: invalid limit rate %q", rule, rule.LimitRate)
+	}
+
+	if !validText(rule.LogPrefix) {
+		return fmt.Errorf("rule %q: invalid log prefix %q", rule, rule.LogPrefix)
+	}
+
+	if !validText(rule.Comment) {
+		return fmt.Errorf("rule %q: invalid comment %q", rule, rule.Comment)
+	}
+
+	switch {
+	case rule.Verdict == "accept", rule.Verdict == "drop":
+	case rule.Verdict == "" && (rule.LogPrefix != "" || rule.AddDPortToSet != ""):
+	default:
+		return fmt.Errorf("rule %q: unsupported verdict %q", rule, rule.Verdict)
+	}
+
+	return nil
+}
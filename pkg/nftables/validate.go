@@ -0,0 +1,65 @@
+package nftables
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/firewall"
+	"github.com/liornoy/node-comm-lib/pkg/policy"
+)
+
+const maxServiceNameLength = 128
+
+var interfaceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,15}$`)
+
+// serviceNameRegex allows the characters of service, pod and process names while rejecting
+// quotes, semicolons, braces and newlines that could break out of the ruleset.
+var serviceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.:/@ +-]*$`)
+
+var limitRateRegex = regexp.MustCompile(`^[1-9][0-9]*/(second|minute|hour|day)$`)
+
+// validateComDetails validates the fields of the ComDetails rendered into the ruleset.
+func validateComDetails(cds []commatrix.ComDetails) error {
+	for _, cd := range cds {
+		if cd.Protocol != "TCP" && cd.Protocol != "UDP" {
+			continue
+		}
+
+		if err := firewall.ValidatePort(cd.Port); err != nil {
+			return fmt.Errorf("invalid ComDetails %s: %w", cd, err)
+		}
+
+		if !validText(cd.ServiceName) {
+			return fmt.Errorf("invalid ComDetails %s: invalid service name %q", cd, cd.ServiceName)
+		}
+	}
+
+	return nil
+}
+
+// validText returns whether the text can be quoted in the ruleset, e.g. as a comment or a log prefix.
+func validText(text string) bool {
+	return len(text) <= maxServiceNameLength && serviceNameRegex.MatchString(text)
+}
+
+func validateAlwaysAllowedPorts(ports []firewall.Port) error {
+	for _, p := range ports {
+		if err := firewall.ValidateAllowedPort(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateSources validates the resolved sources, whose rule names are also used as set names.
+func validateSources(sources policy.Resolved) error {
+	for _, rule := range sources.Rules {
+		if !identifierRegex.MatchString(rule.Name) {
+			return fmt.Errorf("invalid source rule name %q", rule.Name)
+		}
+	}
+
+	return sources.Validate()
+}
@@ -1,9 +1,17 @@
 package pointer
 
+func BoolPtr(b bool) *bool {
+	return &b
+}
+
 func Int32Ptr(n int32) *int32 {
 	return &n
 }
 
+func Int64Ptr(n int64) *int64 {
+	return &n
+}
+
 func StrPtr(s string) *string {
 	return &s
 }
@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+var networkConfigGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Network"}
+
+// ClusterNetworks returns the cluster network CIDRs of the cluster configuration: the
+// cluster networks of the OpenShift Network config, or else the pod subnet of the
+// kubeadm-config ConfigMap. It returns no CIDRs if the cluster has neither.
+func ClusterNetworks(ctx context.Context, c client.Client) ([]string, error) {
+	networks, err := openshiftClusterNetworks(ctx, c)
+	if err != nil || len(networks) > 0 {
+		return networks, err
+	}
+
+	return kubeadmClusterNetworks(ctx, c)
+}
+
+func openshiftClusterNetworks(ctx context.Context, c client.Client) ([]string, error) {
+	network := &unstructured.Unstructured{}
+	network.SetGroupVersionKind(networkConfigGVK)
+	err := c.Get(ctx, client.ObjectKey{Name: "cluster"}, network)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the cluster network config: %w", err)
+	}
+
+	entries, _, err := unstructured.NestedSlice(network.Object, "spec", "clusterNetwork")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the cluster network config: %w", err)
+	}
+
+	res := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cidr, ok := fields["cidr"].(string); ok && cidr != "" {
+			res = append(res, cidr)
+		}
+	}
+
+	return res, nil
+}
+
+func kubeadmClusterNetworks(ctx context.Context, c client.Client) ([]string, error) {
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "kubeadm-config"}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the kubeadm config: %w", err)
+	}
+
+	var config struct {
+		Networking struct {
+			PodSubnet string `json:"podSubnet"`
+		} `json:"networking"`
+	}
+	err = yaml.Unmarshal([]byte(cm.Data["ClusterConfiguration"]), &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the kubeadm config: %w", err)
+	}
+	if config.Networking.PodSubnet == "" {
+		return nil, nil
+	}
+
+	return strings.Split(config.Networking.PodSubnet, ","), nil
+}
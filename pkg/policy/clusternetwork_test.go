@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterNetworks(t *testing.T) {
+	network := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "config.openshift.io/v1",
+		"kind":       "Network",
+		"metadata":   map[string]interface{}{"name": "cluster"},
+		"spec": map[string]interface{}{
+			"clusterNetwork": []interface{}{
+				map[string]interface{}{"cidr": "10.128.0.0/14", "hostPrefix": int64(23)},
+				map[string]interface{}{"cidr": "fd01::/48", "hostPrefix": int64(64)},
+			},
+		},
+	}}
+	kubeadmConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kubeadm-config"},
+		Data: map[string]string{
+			"ClusterConfiguration": "networking:\n  podSubnet: 10.244.0.0/16,fd00:10:244::/56\n  serviceSubnet: 10.96.0.0/12\n",
+		},
+	}
+
+	tests := []struct {
+		desc     string
+		objects  []client.Object
+		expected []string
+	}{
+		{
+			desc:     "openshift",
+			objects:  []client.Object{network, kubeadmConfig},
+			expected: []string{"10.128.0.0/14", "fd01::/48"},
+		},
+		{
+			desc:     "kubeadm",
+			objects:  []client.Object{kubeadmConfig},
+			expected: []string{"10.244.0.0/16", "fd00:10:244::/56"},
+		},
+		{
+			desc:     "none",
+			objects:  nil,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		scheme := runtime.NewScheme()
+		if err := corev1.AddToScheme(scheme); err != nil {
+			t.Fatalf("test \"%s\" failed: %v", test.desc, err)
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.objects...).Build()
+
+		res, err := ClusterNetworks(context.TODO(), c)
+		if err != nil {
+			t.Fatalf("test \"%s\" failed: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test \"%s\" failed: got %v, expected %v", test.desc, res, test.expected)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+var ruleNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// Policy restricts the sources allowed to reach the ports of the matrix.
+// Ports that match no rule accept any source.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule restricts the sources of the ComDetails it matches. Empty match fields match any value.
+type Rule struct {
+	// Name identifies the rule, and is used as the name of the generated firewall sets.
+	Name        string   `json:"name"`
+	Protocol    string   `json:"protocol,omitempty"`
+	Ports       []string `json:"ports,omitempty"`
+	NodeRole    string   `json:"nodeRole,omitempty"`
+	ServiceName string   `json:"serviceName,omitempty"`
+	Sources     Sources  `json:"sources"`
+}
+
+// Sources are the peers allowed to reach the ports of a rule.
+type Sources struct {
+	// CIDRs are explicitly allowed source networks.
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Roles are node roles whose node addresses are allowed.
+	Roles []string `json:"roles,omitempty"`
+	// ClusterNetwork allows the addresses of all nodes, their pod networks and the configured cluster networks.
+	ClusterNetwork bool `json:"clusterNetwork,omitempty"`
+}
+
+// ResolvedRule is a Rule with its sources resolved to CIDRs.
+type ResolvedRule struct {
+	Rule
+	IPv4 []string
+	IPv6 []string
+}
+
+type Resolved struct {
+	Rules []ResolvedRule
+}
+
+// Default returns a policy allowing the etcd ports only from the master nodes,
+// and the kubelet port only from the cluster network.
+func Default() Policy {
+	return Policy{Rules: []Rule{
+		{
+			Name:     "etcd",
+			Protocol: "TCP",
+			Ports:    []string{"2379", "2380"},
+			Sources:  Sources{Roles: []string{"master"}},
+		},
+		{
+			Name:     "kubelet",
+			Protocol: "TCP",
+			Ports:    []string{"10250"},
+			Sources:  Sources{ClusterNetwork: true},
+		},
+	}}
+}
+
+// LoadFile reads a Policy from a YAML or JSON file.
+func LoadFile(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var p Policy
+	err = yaml.UnmarshalStrict(data, &p)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	return p, p.Validate()
+}
+
+func (p Policy) Validate() error {
+	names := make(map[string]bool)
+	for _, r := range p.Rules {
+		if !ruleNameRegex.MatchString(r.Name) {
+			return fmt.Errorf("invalid rule name %q", r.Name)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		for _, cidr := range r.Sources.CIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("rule %s: %w", r.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// NeedsNodes returns whether a rule allows node addresses, which Resolve reads from the nodes.
+func (p Policy) NeedsNodes() bool {
+	for _, r := range p.Rules {
+		if len(r.Sources.Roles) > 0 || r.Sources.ClusterNetwork {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NeedsClusterNetworks returns whether a rule allows the cluster networks.
+func (p Policy) NeedsClusterNetworks() bool {
+	for _, r := range p.Rules {
+		if r.Sources.ClusterNetwork {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve resolves the sources of every rule from the node addresses and the given cluster networks.
+func (p Policy) Resolve(nodes *corev1.NodeList, clusterNetworks []string) (Resolved, error) {
+	err := p.Validate()
+	if err != nil {
+		return Resolved{}, err
+	}
+
+	for _, cidr := range clusterNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return Resolved{}, fmt.Errorf("invalid cluster network: %w", err)
+		}
+	}
+
+	nodesRoles := commatrix.GetNodesRoles(nodes)
+	res := Resolved{Rules: make([]ResolvedRule, 0, len(p.Rules))}
+	for _, r := range p.Rules {
+		cidrs := append([]string{}, r.Sources.CIDRs...)
+		if r.Sources.ClusterNetwork {
+			cidrs = append(cidrs, clusterNetworks...)
+		}
+
+		for _, node := range nodes.Items {
+			if r.Sources.ClusterNetwork {
+				cidrs = append(cidrs, node.Spec.PodCIDRs...)
+				cidrs = append(cidrs, nodeAddresses(node)...)
+				continue
+			}
+			if hasRole(nodesRoles[node.Name], r.Sources.Roles) {
+				cidrs = append(cidrs, nodeAddresses(node)...)
+			}
+		}
+
+		ipv4, ipv6 := splitFamilies(cidrs)
+		res.Rules = append(res.Rules, ResolvedRule{Rule: r, IPv4: ipv4, IPv6: ipv6})
+	}
+
+	return res, nil
+}
+
+// Match returns the first rule matching the ComDetails.
+func (r Resolved) Match(cd commatrix.ComDetails) (ResolvedRule, bool) {
+	for _, rule := range r.Rules {
+		if rule.matches(cd) {
+			return rule, true
+		}
+	}
+
+	return ResolvedRule{}, false
+}
+
+// Validate returns an error if a rule has an invalid CIDR, or a CIDR of the other address family.
+func (r Resolved) Validate() error {
+	for _, rule := range r.Rules {
+		for _, cidr := range rule.IPv4 {
+			if _, ipNet, err := net.ParseCIDR(cidr); err != nil || ipNet.IP.To4() == nil {
+				return fmt.Errorf("source rule %s: invalid IPv4 CIDR %q", rule.Name, cidr)
+			}
+		}
+
+		for _, cidr := range rule.IPv6 {
+			if _, ipNet, err := net.ParseCIDR(cidr); err != nil || ipNet.IP.To4() != nil {
+				return fmt.Errorf("source rule %s: invalid IPv6 CIDR %q", rule.Name, cidr)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r Rule) matches(cd commatrix.ComDetails) bool {
+	if r.Protocol != "" && r.Protocol != cd.Protocol {
+		return false
+	}
+	if r.NodeRole != "" && !hasRole(cd.NodeRole, []string{r.NodeRole}) {
+		return false
+	}
+	if r.ServiceName != "" && r.ServiceName != cd.ServiceName {
+		return false
+	}
+	if len(r.Ports) == 0 {
+		return true
+	}
+
+	for _, port := range r.Ports {
+		if port == cd.Port {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasRole returns whether the node role is one of the roles, treating
+// "master-worker" nodes as both master and worker nodes.
+func hasRole(nodeRole string, roles []string) bool {
+	for _, role := range roles {
+		if role == nodeRole {
+			return true
+		}
+		if nodeRole == "master-worker" && (role == "master" || role == "worker") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nodeAddresses(node corev1.Node) []string {
+	res := make([]string, 0)
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != corev1.NodeInternalIP {
+			continue
+		}
+
+		ip := net.ParseIP(addr.Address)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			res = append(res, ip.String()+"/32")
+		} else {
+			res = append(res, ip.String()+"/128")
+		}
+	}
+
+	return res
+}
+
+// splitFamilies returns the sorted IPv4 and IPv6 CIDRs, without the CIDRs contained in other CIDRs,
+// so they can be used as elements of interval sets.
+func splitFamilies(cidrs []string) ([]string, []string) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+
+	var (
+		ipv4 = make([]string, 0)
+		ipv6 = make([]string, 0)
+		seen = make(map[string]bool)
+	)
+	for i, ipNet := range nets {
+		normalized := ipNet.String()
+		if seen[normalized] || containedInOther(i, nets) {
+			continue
+		}
+		seen[normalized] = true
+
+		if ipNet.IP.To4() != nil {
+			ipv4 = append(ipv4, normalized)
+		} else {
+			ipv6 = append(ipv6, normalized)
+		}
+	}
+	sort.Strings(ipv4)
+	sort.Strings(ipv6)
+
+	return ipv4, ipv6
+}
+
+// containedInOther returns whether nets[i] is contained in a larger network of nets.
+func containedInOther(i int, nets []*net.IPNet) bool {
+	ones, bits := nets[i].Mask.Size()
+	for j, other := range nets {
+		otherOnes, otherBits := other.Mask.Size()
+		if j == i || otherBits != bits || otherOnes >= ones {
+			continue
+		}
+		if other.Contains(nets[i].IP) {
+			return true
+		}
+	}
+
+	return false
+}
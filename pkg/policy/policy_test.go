@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+)
+
+func newNode(name, role, address, podCIDR string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{role: ""},
+		},
+		Spec: corev1.NodeSpec{
+			PodCIDRs: []string{podCIDR},
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: address},
+				{Type: corev1.NodeHostName, Address: name},
+			},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	nodes := &corev1.NodeList{Items: []corev1.Node{
+		newNode("master-0", consts.MasterRole, "10.0.0.1", "10.128.0.0/23"),
+		newNode("master-1", consts.MasterRole, "fd00::2", "fd01::/64"),
+		newNode("worker-0", consts.WorkerRole, "10.0.0.3", "10.128.2.0/23"),
+	}}
+
+	resolved, err := Default().Resolve(nodes, []string{"172.30.0.0/16", "10.128.0.0/14"})
+	if err != nil {
+		t.Fatalf("failed to resolve policy: %s", err)
+	}
+
+	tests := []struct {
+		desc         string
+		cd           commatrix.ComDetails
+		expectedRule string
+		expectedIPv4 []string
+		expectedIPv6 []string
+	}{
+		{
+			desc:         "etcd-from-masters",
+			cd:           commatrix.ComDetails{Protocol: "TCP", Port: "2380", NodeRole: "master"},
+			expectedRule: "etcd",
+			expectedIPv4: []string{"10.0.0.1/32"},
+			expectedIPv6: []string{"fd00::2/128"},
+		},
+		{
+			desc:         "kubelet-from-cluster-network",
+			cd:           commatrix.ComDetails{Protocol: "TCP", Port: "10250", NodeRole: "worker"},
+			expectedRule: "kubelet",
+			expectedIPv4: []string{"10.0.0.1/32", "10.0.0.3/32", "10.128.0.0/14", "172.30.0.0/16"},
+			expectedIPv6: []string{"fd00::2/128", "fd01::/64"},
+		},
+		{
+			desc: "unrestricted-port",
+			cd:   commatrix.ComDetails{Protocol: "TCP", Port: "6443", NodeRole: "master"},
+		},
+	}
+
+	for _, test := range tests {
+		rule, ok := resolved.Match(test.cd)
+		if !ok {
+			if test.expectedRule != "" {
+				t.Fatalf("test \"%s\" failed: no rule matched", test.desc)
+			}
+			continue
+		}
+
+		if rule.Name != test.expectedRule {
+			t.Fatalf("test \"%s\" failed: got rule %s, expected %s", test.desc, rule.Name, test.expectedRule)
+		}
+		if !equal(rule.IPv4, test.expectedIPv4) || !equal(rule.IPv6, test.expectedIPv6) {
+			t.Fatalf("test \"%s\" failed: got %v %v, expected %v %v", test.desc, rule.IPv4, rule.IPv6, test.expectedIPv4, test.expectedIPv6)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		desc   string
+		policy Policy
+	}{
+		{
+			desc:   "invalid-name",
+			policy: Policy{Rules: []Rule{{Name: "etcd peers"}}},
+		},
+		{
+			desc:   "duplicate-name",
+			policy: Policy{Rules: []Rule{{Name: "etcd"}, {Name: "etcd"}}},
+		},
+		{
+			desc:   "invalid-cidr",
+			policy: Policy{Rules: []Rule{{Name: "etcd", Sources: Sources{CIDRs: []string{"10.0.0.1"}}}}},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.policy.Validate(); err == nil {
+			t.Fatalf("test \"%s\" failed: expected error", test.desc)
+		}
+	}
+}
+
+func TestValidateResolved(t *testing.T) {
+	tests := []struct {
+		desc        string
+		resolved    Resolved
+		expectedErr bool
+	}{
+		{
+			desc:     "valid",
+			resolved: Resolved{Rules: []ResolvedRule{{Rule: Rule{Name: "etcd"}, IPv4: []string{"10.0.0.1/32"}, IPv6: []string{"fd00::/64"}}}},
+		},
+		{
+			desc:        "ipv6-as-ipv4",
+			resolved:    Resolved{Rules: []ResolvedRule{{Rule: Rule{Name: "etcd"}, IPv4: []string{"fd00::/64"}}}},
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid-cidr",
+			resolved:    Resolved{Rules: []ResolvedRule{{Rule: Rule{Name: "etcd"}, IPv6: []string{"fd00::"}}}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.resolved.Validate()
+		if (err != nil) != test.expectedErr {
+			t.Fatalf("test \"%s\" failed: got error %v, expected error %v", test.desc, err, test.expectedErr)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,295 @@
+package rollout
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/pointer"
+)
+
+const (
+	defaultName      = "commatrix-nftables"
+	defaultNamespace = "commatrix"
+	defaultImage     = "registry.access.redhat.com/ubi9/ubi"
+	defaultFamily    = "ip"
+	defaultTable     = "my_filter"
+
+	rulesDir = "/etc/commatrix"
+
+	// RulesChecksumAnnotation is the pod template annotation holding the checksum of the rules of the
+	// DaemonSet role, so updating the rules in the ConfigMap rolls the pods that load them.
+	RulesChecksumAnnotation = "commatrix/rules-checksum"
+)
+
+// Options controls the generated objects.
+type Options struct {
+	// Name prefixes the names of the generated objects, defaults to commatrix-nftables.
+	Name string
+	// Namespace of the ConfigMap and DaemonSets, defaults to commatrix.
+	Namespace string
+	// Image of the DaemonSets. It must provide sh and chroot, the rules are loaded by the nft binary of the host.
+	Image string
+	// Family and Table of the rulesets, defaults to ip and my_filter. The table is replaced
+	// atomically whenever the rules are loaded, so loading them again does not duplicate them.
+	Family string
+	Table  string
+}
+
+func (o Options) withDefaults() Options {
+	if o.Name == "" {
+		o.Name = defaultName
+	}
+	if o.Namespace == "" {
+		o.Namespace = defaultNamespace
+	}
+	if o.Image == "" {
+		o.Image = defaultImage
+	}
+	if o.Family == "" {
+		o.Family = defaultFamily
+	}
+	if o.Table == "" {
+		o.Table = defaultTable
+	}
+
+	return o
+}
+
+// MachineConfigs returns an OpenShift MachineConfig per node role of the rules (e.g. from nftables.GetRulesByRole).
+// Every MachineConfig writes the rules of its role as an ignition file, and enables a systemd unit loading
+// them before the network is up. master-worker rules are applied to the master pool.
+func MachineConfigs(rules map[string]string, opts Options) ([]unstructured.Unstructured, error) {
+	opts = opts.withDefaults()
+
+	pools := make(map[string]string)
+	res := make([]unstructured.Unstructured, 0, len(rules))
+	for _, role := range sortedRoles(rules) {
+		pool := role
+		if role == "master-worker" {
+			pool = "master"
+		}
+		if pool != "master" && pool != "worker" {
+			return nil, fmt.Errorf("unsupported node role %q, MachineConfigs are rendered per master and worker pool", role)
+		}
+		if other, ok := pools[pool]; ok {
+			return nil, fmt.Errorf("node roles %s and %s are both applied to the %s pool", other, role, pool)
+		}
+		pools[pool] = role
+
+		path := rulesPath(role)
+		content := "data:text/plain;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte(reloadable(rules[role], opts)))
+		unitName := opts.Name + ".service"
+
+		res = append(res, unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "machineconfiguration.openshift.io/v1",
+			"kind":       "MachineConfig",
+			"metadata": map[string]interface{}{
+				"name":   fmt.Sprintf("98-%s-%s", opts.Name, pool),
+				"labels": map[string]interface{}{"machineconfiguration.openshift.io/role": pool},
+			},
+			"spec": map[string]interface{}{
+				"config": map[string]interface{}{
+					"ignition": map[string]interface{}{"version": "3.2.0"},
+					"storage": map[string]interface{}{
+						"files": []interface{}{
+							map[string]interface{}{
+								"path":      path,
+								"mode":      int64(0o600),
+								"overwrite": true,
+								"contents":  map[string]interface{}{"source": content},
+							},
+						},
+					},
+					"systemd": map[string]interface{}{
+						"units": []interface{}{
+							map[string]interface{}{
+								"name":     unitName,
+								"enabled":  true,
+								"contents": systemdUnit(path),
+							},
+						},
+					},
+				},
+			},
+		}})
+	}
+
+	return res, nil
+}
+
+// DaemonSetBundle returns a ConfigMap holding the rules of every node role, and a DaemonSet per node role
+// loading the rules of its role with the nft binary of the host. The pod template of a DaemonSet is
+// annotated with the checksum of the rules of its role, so applying changed rules rolls its pods.
+func DaemonSetBundle(rules map[string]string, opts Options) (*corev1.ConfigMap, []appsv1.DaemonSet, error) {
+	opts = opts.withDefaults()
+
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+		},
+		Data: make(map[string]string, len(rules)),
+	}
+
+	daemonSets := make([]appsv1.DaemonSet, 0, len(rules))
+	for _, role := range sortedRoles(rules) {
+		affinity, err := roleAffinity(role)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data := reloadable(rules[role], opts)
+		cm.Data[role+".nft"] = data
+		daemonSets = append(daemonSets, daemonSet(role, affinity, checksum(data), opts))
+	}
+
+	return cm, daemonSets, nil
+}
+
+func daemonSet(role string, affinity *corev1.Affinity, rulesChecksum string, opts Options) appsv1.DaemonSet {
+	name := opts.Name + "-" + role
+	labels := map[string]string{"app": name}
+	script := fmt.Sprintf("chroot /host nft -f - < %s && sleep infinity", rulesPath(role))
+
+	return appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opts.Namespace,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: map[string]string{RulesChecksumAnnotation: rulesChecksum},
+				},
+				Spec: corev1.PodSpec{
+					HostNetwork: true,
+					Affinity:    affinity,
+					Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Containers: []corev1.Container{
+						{
+							Name:    "nftables",
+							Image:   opts.Image,
+							Command: []string{"/bin/sh", "-c", script},
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: pointer.BoolPtr(true),
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "host", MountPath: "/host"},
+								{Name: "rules", MountPath: rulesDir, ReadOnly: true},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "host",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+							},
+						},
+						{
+							Name: "rules",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: opts.Name},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// roleAffinity returns the node affinity selecting only the nodes of the role, so master-worker nodes
+// are not selected by the master and worker DaemonSets.
+func roleAffinity(role string) (*corev1.Affinity, error) {
+	exists := func(label string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: label, Operator: corev1.NodeSelectorOpExists}
+	}
+	notExists := func(label string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: label, Operator: corev1.NodeSelectorOpDoesNotExist}
+	}
+
+	var requirements []corev1.NodeSelectorRequirement
+	switch role {
+	case "master":
+		requirements = []corev1.NodeSelectorRequirement{exists(consts.MasterRole), notExists(consts.WorkerRole)}
+	case "worker":
+		requirements = []corev1.NodeSelectorRequirement{exists(consts.WorkerRole), notExists(consts.MasterRole)}
+	case "master-worker":
+		requirements = []corev1.NodeSelectorRequirement{exists(consts.MasterRole), exists(consts.WorkerRole)}
+	default:
+		return nil, fmt.Errorf("unsupported node role %q", role)
+	}
+
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: requirements}},
+			},
+		},
+	}, nil
+}
+
+// reloadable prepends the rules with the declaration and deletion of their table, so nft replaces
+// the table in a single transaction instead of adding duplicate rules to it.
+func reloadable(rules string, opts Options) string {
+	preamble := fmt.Sprintf("table %[1]s %[2]s\ndelete table %[1]s %[2]s\n", opts.Family, opts.Table)
+
+	shebang, rest, ok := strings.Cut(rules, "\n")
+	if ok && strings.HasPrefix(shebang, "#!") {
+		return shebang + "\n" + preamble + rest
+	}
+
+	return preamble + rules
+}
+
+func systemdUnit(path string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Load the communication matrix nftables rules
+Wants=network-pre.target
+Before=network-pre.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/usr/sbin/nft -f %s
+
+[Install]
+WantedBy=multi-user.target
+`, path)
+}
+
+func rulesPath(role string) string {
+	return rulesDir + "/" + role + ".nft"
+}
+
+func sortedRoles(rules map[string]string) []string {
+	res := make([]string, 0, len(rules))
+	for role := range rules {
+		res = append(res, role)
+	}
+	sort.Strings(res)
+
+	return res
+}
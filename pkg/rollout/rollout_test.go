@@ -0,0 +1,104 @@
+package rollout
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var testRules = map[string]string{
+	"master": "#!/usr/sbin/nft -f\ntable ip my_filter {\n}\n",
+	"worker": "#!/usr/sbin/nft -f\ntable ip my_filter {\n}\n",
+}
+
+func TestMachineConfigs(t *testing.T) {
+	mcs, err := MachineConfigs(testRules, Options{})
+	if err != nil {
+		t.Fatalf("failed to create MachineConfigs: %s", err)
+	}
+
+	if len(mcs) != 2 || mcs[1].GetName() != "98-commatrix-nftables-worker" {
+		t.Fatalf("unexpected MachineConfigs: %v", mcs)
+	}
+
+	if mcs[1].GetLabels()["machineconfiguration.openshift.io/role"] != "worker" {
+		t.Fatalf("got labels %v, expected the worker role", mcs[1].GetLabels())
+	}
+
+	files, _, err := unstructured.NestedSlice(mcs[1].Object, "spec", "config", "storage", "files")
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected a single file, got %v (err: %v)", files, err)
+	}
+
+	source, _, _ := unstructured.NestedString(files[0].(map[string]interface{}), "contents", "source")
+	content, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(source, "data:text/plain;charset=utf-8;base64,"))
+	if err != nil {
+		t.Fatalf("failed to decode file contents: %s", err)
+	}
+
+	expected := "#!/usr/sbin/nft -f\ntable ip my_filter\ndelete table ip my_filter\ntable ip my_filter {\n}\n"
+	if string(content) != expected {
+		t.Fatalf("got file contents:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestMachineConfigsInvalidRoles(t *testing.T) {
+	tests := []struct {
+		desc  string
+		rules map[string]string
+	}{
+		{
+			desc:  "unsupported role",
+			rules: map[string]string{"infra": ""},
+		},
+		{
+			desc:  "master and master-worker",
+			rules: map[string]string{"master": "", "master-worker": ""},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := MachineConfigs(test.rules, Options{}); err == nil {
+			t.Fatalf("test \"%s\" failed: expected error", test.desc)
+		}
+	}
+}
+
+func TestDaemonSetBundle(t *testing.T) {
+	cm, daemonSets, err := DaemonSetBundle(testRules, Options{Namespace: "fw"})
+	if err != nil {
+		t.Fatalf("failed to create DaemonSet bundle: %s", err)
+	}
+
+	if cm.Namespace != "fw" || len(cm.Data) != 2 || !strings.Contains(cm.Data["master.nft"], "delete table ip my_filter") {
+		t.Fatalf("unexpected ConfigMap: %v", cm)
+	}
+
+	if len(daemonSets) != 2 || daemonSets[0].Name != "commatrix-nftables-master" {
+		t.Fatalf("unexpected DaemonSets: %v", daemonSets)
+	}
+
+	terms := daemonSets[0].Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 2 {
+		t.Fatalf("expected the master DaemonSet to exclude worker nodes, got %v", terms)
+	}
+
+	changed := map[string]string{"master": testRules["master"] + "\n", "worker": testRules["worker"]}
+	_, changedDaemonSets, err := DaemonSetBundle(changed, Options{Namespace: "fw"})
+	if err != nil {
+		t.Fatalf("failed to create DaemonSet bundle: %s", err)
+	}
+	for i, expectedRoll := range []bool{true, false} {
+		before := daemonSets[i].Spec.Template.Annotations[RulesChecksumAnnotation]
+		after := changedDaemonSets[i].Spec.Template.Annotations[RulesChecksumAnnotation]
+		if before == "" || (before != after) != expectedRoll {
+			t.Fatalf("DaemonSet %s: got checksums %q and %q, expected a change %v", daemonSets[i].Name, before, after, expectedRoll)
+		}
+	}
+
+	if _, _, err := DaemonSetBundle(map[string]string{"infra": ""}, Options{}); err == nil {
+		t.Fatalf("expected error for unsupported role")
+	}
+}
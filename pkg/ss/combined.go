@@ -0,0 +1,60 @@
+package ss
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// netids maps the ss Netid column to the ComDetails protocol. Raw sockets are not supported,
+// since the port column of their lines is an IP protocol number, not a port.
+var netids = map[string]string{
+	"tcp":  "TCP",
+	"udp":  "UDP",
+	"sctp": "SCTP",
+}
+
+// CombinedToComDetails converts the output of `ss -tuanpH` (with the Netid column) to ComDetails,
+// detecting the protocol of every line.
+func CombinedToComDetails(ssOutput string, role string) []commatrix.ComDetails {
+	return SocketsToComDetails(ParseSSCombined(ssOutput), role)
+}
+
+// ParseSSCombined parses the output of `ss -tuanpH` (with the Netid column) to Sockets.
+// Lines of unsupported netids, such as raw and unix sockets, and the header line are ignored.
+// SCTP sockets are only listed with the -S flag, e.g. `ss -tuanpSH`.
+func ParseSSCombined(ssOutput string) []Socket {
+	res := make([]Socket, 0)
+	reader := strings.NewReader(ssOutput)
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Netid State Recv-Q Send-Q Local Peer [Process]
+		if len(fields) < 6 {
+			continue
+		}
+
+		protocol, ok := netids[fields[0]]
+		if !ok {
+			continue
+		}
+
+		process := ""
+		if len(fields) > 6 {
+			process = mainProcess(fields[6])
+		}
+
+		address, port := splitAddress(fields[4])
+		res = append(res, Socket{
+			Protocol: protocol,
+			Address:  address,
+			Port:     port,
+			State:    fields[1],
+			Process:  process,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,73 @@
+package ss
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// LsofToComDetails converts the output of `lsof -nP -iTCP -sTCP:LISTEN -iUDP` to ComDetails.
+func LsofToComDetails(lsofOutput string, role string) []commatrix.ComDetails {
+	return SocketsToComDetails(ParseLsof(lsofOutput), role)
+}
+
+// ParseLsof parses the output of `lsof -nP -iTCP -sTCP:LISTEN -iUDP` to Sockets.
+// Note that lsof truncates the command names to 9 characters unless it runs with `+c 0`.
+func ParseLsof(lsofOutput string) []Socket {
+	res := make([]Socket, 0)
+	reader := strings.NewReader(lsofOutput)
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// COMMAND PID USER FD TYPE DEVICE SIZE/OFF NODE NAME [STATE]
+		if len(fields) < 9 {
+			continue
+		}
+
+		protocol := fields[7]
+		if protocol != "TCP" && protocol != "UDP" {
+			continue
+		}
+
+		// Connected sockets are reported as "local->remote".
+		name := fields[8]
+		connected := strings.Contains(name, "->")
+		if connected {
+			name = name[:strings.Index(name, "->")]
+		}
+
+		state := StateUnconnected
+		if connected {
+			state = StateEstablished
+		}
+		if protocol == "TCP" {
+			state = ""
+			if len(fields) > 9 {
+				state = lsofState(fields[9])
+			}
+		}
+
+		address, port := splitAddress(name)
+		res = append(res, Socket{
+			Protocol: protocol,
+			Address:  address,
+			Port:     port,
+			State:    state,
+			Process:  fields[0],
+		})
+	}
+
+	return res
+}
+
+// lsofState maps a TCP state of lsof, e.g. "(ESTABLISHED)", to the ss state.
+func lsofState(s string) string {
+	state := strings.Trim(s, "()")
+	if mapped, ok := netstatStates[state]; ok {
+		return mapped
+	}
+
+	return state
+}
@@ -0,0 +1,105 @@
+package ss
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// NetstatToComDetails converts the output of `netstat -tulpn` or `netstat -tuanp` to ComDetails.
+func NetstatToComDetails(netstatOutput string, role string) []commatrix.ComDetails {
+	return SocketsToComDetails(ParseNetstat(netstatOutput), role)
+}
+
+// ParseNetstat parses the output of `netstat -tulpn` or `netstat -tuanp` to Sockets.
+// `netstat -l` lists only the listening sockets, so the unconnected UDP sockets of its
+// output are reported in the LISTEN state. The output is recognised by its header.
+func ParseNetstat(netstatOutput string) []Socket {
+	res := make([]Socket, 0)
+	reader := strings.NewReader(netstatOutput)
+	scanner := bufio.NewScanner(reader)
+	onlyServers := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, netstatOnlyServersHeader) {
+			onlyServers = true
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+
+		protocol := netstatProtocol(fields[0])
+		if protocol == "" {
+			continue
+		}
+
+		// Unconnected UDP sockets have an empty State column, and the program column may contain spaces.
+		state := StateUnconnected
+		if onlyServers && protocol == "UDP" {
+			state = StateListen
+		}
+		programIdx := 5
+		if netstatStates[fields[5]] != "" {
+			if len(fields) < 7 {
+				continue
+			}
+			state = netstatStates[fields[5]]
+			programIdx = 6
+		}
+
+		address, port := splitAddress(fields[3])
+		res = append(res, Socket{
+			Protocol: protocol,
+			Address:  address,
+			Port:     port,
+			State:    state,
+			Process:  netstatProgram(fields[programIdx]),
+		})
+	}
+
+	return res
+}
+
+// netstatOnlyServersHeader is the header netstat prints when listing only the listening sockets (-l).
+const netstatOnlyServersHeader = "Active Internet connections (only servers)"
+
+// netstatStates maps the netstat states to the ss states. Other states are reported as they are.
+var netstatStates = map[string]string{
+	"LISTEN":      StateListen,
+	"ESTABLISHED": StateEstablished,
+	"SYN_SENT":    "SYN-SENT",
+	"SYN_RECV":    "SYN-RECV",
+	"FIN_WAIT1":   "FIN-WAIT-1",
+	"FIN_WAIT2":   "FIN-WAIT-2",
+	"TIME_WAIT":   "TIME-WAIT",
+	"CLOSE_WAIT":  "CLOSE-WAIT",
+	"LAST_ACK":    "LAST-ACK",
+	"CLOSING":     "CLOSING",
+	"CLOSE":       "UNCONN",
+}
+
+func netstatProtocol(proto string) string {
+	switch proto {
+	case "tcp", "tcp6":
+		return "TCP"
+	case "udp", "udp6":
+		return "UDP"
+	}
+
+	return ""
+}
+
+// netstatProgram returns the program name of a "PID/Program name" column.
+func netstatProgram(s string) string {
+	idx := strings.Index(s, "/")
+	if idx < 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(s[idx+1:], ":")
+}
@@ -0,0 +1,90 @@
+package ss
+
+import (
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+// Socket states, named as ss reports them. The parsers of the other utilities map their states to these.
+const (
+	StateListen      = "LISTEN"
+	StateEstablished = "ESTAB"
+	StateUnconnected = "UNCONN"
+)
+
+// Socket is a socket record parsed from the output of one of the supported
+// node utilities (ss, netstat or lsof).
+type Socket struct {
+	Protocol string
+	Address  string
+	Port     string
+	State    string
+	Process  string
+}
+
+// Listening returns whether the socket serves its port: TCP and SCTP sockets in the LISTEN state,
+// and UDP sockets in the ESTAB state. All the parsers share this rule, so the same node yields the
+// same ComDetails whichever utility listed its sockets. UDP sockets are also listening in the LISTEN
+// state, which only the parsers of listings restricted to the listening sockets (`netstat -l`) report.
+func (s Socket) Listening() bool {
+	switch s.Protocol {
+	case "TCP", "SCTP":
+		return s.State == StateListen
+	case "UDP":
+		return s.State == StateEstablished || s.State == StateListen
+	}
+
+	return false
+}
+
+var optionalProcesses = map[string]bool{
+	"rpcbind":   false,
+	"sshd":      false,
+	"rpc.statd": false,
+}
+
+// SocketsToComDetails converts the listening, non-loopback sockets to ComDetails of the given role.
+func SocketsToComDetails(sockets []Socket, role string) []commatrix.ComDetails {
+	res := make([]commatrix.ComDetails, 0)
+	for _, s := range sockets {
+		if skipSocket(s) {
+			continue
+		}
+
+		required := true
+		if _, ok := optionalProcesses[s.Process]; ok {
+			required = false
+		}
+
+		res = append(res, commatrix.ComDetails{
+			Direction:   "ingress",
+			Protocol:    s.Protocol,
+			Port:        s.Port,
+			NodeRole:    role,
+			ServiceName: s.Process,
+			Required:    required})
+	}
+
+	return res
+}
+
+func skipSocket(s Socket) bool {
+	return !s.Listening() || s.Port == "" || isLoopback(s.Address)
+}
+
+func isLoopback(address string) bool {
+	address = strings.Trim(address, "[]")
+
+	return strings.HasPrefix(address, "127.0.0") || address == "::1"
+}
+
+// splitAddress splits an "address:port" pair, where the address may be an IPv6 address.
+func splitAddress(s string) (string, string) {
+	idx := strings.LastIndex(s, ":")
+	if idx < 0 {
+		return s, ""
+	}
+
+	return s[:idx], s[idx+1:]
+}
@@ -7,61 +7,43 @@ import (
 	"github.com/liornoy/node-comm-lib/pkg/commatrix"
 )
 
+// ToComDetails converts the output of `ss -anplt` (TCP) or `ss -anplu` (UDP) to ComDetails.
 func ToComDetails(ssOutput string, role string, protocol string) []commatrix.ComDetails {
-	res := make([]commatrix.ComDetails, 0)
+	return SocketsToComDetails(ParseSS(ssOutput, protocol), role)
+}
+
+// ParseSS parses the output of `ss -anplt` (TCP) or `ss -anplu` (UDP) to Sockets of the given protocol.
+func ParseSS(ssOutput string, protocol string) []Socket {
+	res := make([]Socket, 0)
 	reader := strings.NewReader(ssOutput)
 	scanner := bufio.NewScanner(reader)
 
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		if skipSSline(line, protocol) {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 {
 			continue
 		}
 
-		comDetail := defineComDetail(line, protocol, role)
-		res = append(res, comDetail)
+		address, port := splitAddress(fields[3])
+		res = append(res, Socket{
+			Protocol: protocol,
+			Address:  address,
+			Port:     port,
+			State:    fields[0],
+			Process:  mainProcess(fields[5]),
+		})
 	}
 
 	return res
 }
 
-func skipSSline(line, protocol string) bool {
-	fields := strings.Fields(line)
-
-	shouldSkip := strings.Contains(line, "127.0.0") ||
-		protocol == "TCP" && !strings.Contains(line, "LISTEN") ||
-		protocol == "UDP" && !strings.Contains(line, "ESTAB") ||
-		len(fields) != 6
-
-	return shouldSkip
-}
-
-func defineComDetail(line string, protocol string, role string) commatrix.ComDetails {
-	optionalProcesses := map[string]bool{
-		"rpcbind":   false,
-		"sshd":      false,
-		"rpc.statd": false,
-	}
-	fields := strings.Fields(line)
-	processes := getStrBetweenDoubleQuotes(fields[5])
-	mainProcess := processes[0]
-
-	idx := strings.LastIndex(fields[3], ":")
-	port := fields[3][idx+1:]
-
-	required := true
-	if _, ok := optionalProcesses[mainProcess]; ok {
-		required = false
+func mainProcess(s string) string {
+	processes := getStrBetweenDoubleQuotes(s)
+	if len(processes) == 0 {
+		return ""
 	}
 
-	return commatrix.ComDetails{
-		Direction:   "ingress",
-		Protocol:    protocol,
-		Port:        port,
-		NodeRole:    role,
-		ServiceName: mainProcess,
-		Required:    required}
+	return processes[0]
 }
 
 func getStrBetweenDoubleQuotes(s string) []string {
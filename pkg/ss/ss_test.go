@@ -0,0 +1,191 @@
+package ss
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/commatrix"
+)
+
+const (
+	ssTCPOutput = `State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+LISTEN 0      4096         0.0.0.0:10250      0.0.0.0:*    users:(("kubelet",pid=1,fd=1))
+LISTEN 0      4096       127.0.0.1:10248      0.0.0.0:*    users:(("kubelet",pid=1,fd=2))
+LISTEN 0      128             [::]:22            [::]:*    users:(("sshd",pid=2,fd=3))
+ESTAB  0      0         10.0.0.1:6443     10.0.0.2:4444    users:(("kube-apiserver",pid=4,fd=5))
+`
+	ssUDPOutput = `State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+ESTAB  0      0         10.0.0.1:6081     10.0.0.2:6081 users:(("ovs-vswitchd",pid=3,fd=4))
+`
+	ssCombinedOutput = `Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+tcp   LISTEN 0      4096         0.0.0.0:10250      0.0.0.0:*    users:(("kubelet",pid=1,fd=1))
+tcp   LISTEN 0      4096       127.0.0.1:10248      0.0.0.0:*    users:(("kubelet",pid=1,fd=2))
+udp   UNCONN 0      0            0.0.0.0:6081       0.0.0.0:*
+udp   ESTAB  0      0           10.0.0.1:6081      10.0.0.2:6081 users:(("ovs-vswitchd",pid=3,fd=4))
+udp   UNCONN 0      0          127.0.0.1:323        0.0.0.0:*    users:(("chronyd",pid=6,fd=5))
+sctp  LISTEN 0      128             [::]:9899          [::]:*    users:(("sctp-server",pid=7,fd=3))
+raw   UNCONN 0      0            0.0.0.0:112        0.0.0.0:*    users:(("keepalived",pid=8,fd=9))
+u_str LISTEN 0      4096 /run/systemd/private 1234 * 0       users:(("systemd",pid=1,fd=10))
+`
+	netstatOutput = `Active Internet connections (servers and established)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name
+tcp        0      0 0.0.0.0:10250           0.0.0.0:*               LISTEN      1/kubelet
+tcp        0      0 127.0.0.1:10248         0.0.0.0:*               LISTEN      1/kubelet
+tcp6       0      0 :::22                   :::*                    LISTEN      2/sshd: /usr/sbin
+udp        0      0 0.0.0.0:6081            0.0.0.0:*                           -
+udp        0      0 0.0.0.0:111             0.0.0.0:*                           5/rpcbind
+udp        0      0 10.0.0.1:6081           10.0.0.2:6081           ESTABLISHED 3/ovs-vswitchd
+tcp        0      0 10.0.0.1:6443           10.0.0.2:4444           ESTABLISHED 4/kube-apiserver
+`
+	netstatListeningOutput = `Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name
+tcp        0      0 0.0.0.0:10250           0.0.0.0:*               LISTEN      1/kubelet
+tcp        0      0 127.0.0.1:10248         0.0.0.0:*               LISTEN      1/kubelet
+udp        0      0 0.0.0.0:6081            0.0.0.0:*                           3/ovs-vswitchd
+udp        0      0 127.0.0.1:323           0.0.0.0:*                           6/chronyd
+`
+	lsofOutput = `COMMAND     PID USER   FD   TYPE DEVICE SIZE/OFF NODE NAME
+kubelet       1 root   20u  IPv6  34567      0t0  TCP *:10250 (LISTEN)
+kubelet       1 root   21u  IPv4  34568      0t0  TCP 127.0.0.1:10248 (LISTEN)
+sshd          2 root    3u  IPv4  23456      0t0  TCP *:22 (LISTEN)
+chronyd       6 chrony  5u  IPv6  12345      0t0  UDP [::1]:323
+rpcbind       5 rpc     6u  IPv4  12346      0t0  UDP *:111
+ovs-vswit     3 root    7u  IPv4  12347      0t0  UDP 10.0.0.1:6081->10.0.0.2:6081
+`
+)
+
+func TestToComDetails(t *testing.T) {
+	tests := []struct {
+		desc     string
+		res      []commatrix.ComDetails
+		expected []commatrix.ComDetails
+	}{
+		{
+			desc: "ss-tcp",
+			res:  ToComDetails(ssTCPOutput, "master", "TCP"),
+			expected: []commatrix.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "master", ServiceName: "kubelet", Required: true},
+				{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "master", ServiceName: "sshd", Required: false},
+			},
+		},
+		{
+			desc: "ss-udp",
+			res:  ToComDetails(ssUDPOutput, "master", "UDP"),
+			expected: []commatrix.ComDetails{
+				{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "master", ServiceName: "ovs-vswitchd", Required: true},
+			},
+		},
+		{
+			desc: "ss-combined",
+			res:  CombinedToComDetails(ssCombinedOutput, "master"),
+			expected: []commatrix.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "master", ServiceName: "kubelet", Required: true},
+				{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "master", ServiceName: "ovs-vswitchd", Required: true},
+				{Direction: "ingress", Protocol: "SCTP", Port: "9899", NodeRole: "master", ServiceName: "sctp-server", Required: true},
+			},
+		},
+		{
+			desc: "netstat",
+			res:  NetstatToComDetails(netstatOutput, "worker"),
+			expected: []commatrix.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+				{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "worker", ServiceName: "sshd", Required: false},
+				{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "worker", ServiceName: "ovs-vswitchd", Required: true},
+			},
+		},
+		{
+			desc: "netstat-listening",
+			res:  NetstatToComDetails(netstatListeningOutput, "worker"),
+			expected: []commatrix.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+				{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "worker", ServiceName: "ovs-vswitchd", Required: true},
+			},
+		},
+		{
+			desc: "lsof",
+			res:  LsofToComDetails(lsofOutput, "worker"),
+			expected: []commatrix.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+				{Direction: "ingress", Protocol: "TCP", Port: "22", NodeRole: "worker", ServiceName: "sshd", Required: false},
+				{Direction: "ingress", Protocol: "UDP", Port: "6081", NodeRole: "worker", ServiceName: "ovs-vswit", Required: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if len(test.res) != len(test.expected) {
+			t.Fatalf("test \"%s\" failed: got %d ComDetails, expected %d: %v", test.desc, len(test.res), len(test.expected), test.res)
+		}
+
+		for i := range test.expected {
+			if test.res[i] != test.expected[i] {
+				t.Fatalf("test \"%s\" failed: got %v, expected %v", test.desc, test.res[i], test.expected[i])
+			}
+		}
+	}
+}
+
+// TestSameSocketsSameComDetails feeds the same sockets listed by every utility, and expects the same ComDetails.
+func TestSameSocketsSameComDetails(t *testing.T) {
+	var (
+		ssTCP = `State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+LISTEN 0      4096         0.0.0.0:10250      0.0.0.0:*    users:(("kubelet",pid=1,fd=1))
+LISTEN 0      4096       127.0.0.1:10248      0.0.0.0:*    users:(("kubelet",pid=1,fd=2))
+ESTAB  0      0         10.0.0.1:10250     10.0.0.2:4444    users:(("kubelet",pid=1,fd=3))
+`
+		ssUDP = `State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+UNCONN 0      0            0.0.0.0:111        0.0.0.0:*    users:(("rpcbind",pid=5,fd=6))
+ESTAB  0      0         10.0.0.1:319       10.0.0.2:319    users:(("ptp4l",pid=9,fd=4))
+`
+		netstat = `Active Internet connections (servers and established)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name
+tcp        0      0 0.0.0.0:10250           0.0.0.0:*               LISTEN      1/kubelet
+tcp        0      0 127.0.0.1:10248         0.0.0.0:*               LISTEN      1/kubelet
+tcp        0      0 10.0.0.1:10250          10.0.0.2:4444           ESTABLISHED 1/kubelet
+udp        0      0 0.0.0.0:111             0.0.0.0:*                           5/rpcbind
+udp        0      0 10.0.0.1:319            10.0.0.2:319            ESTABLISHED 9/ptp4l
+`
+		lsof = `COMMAND     PID USER   FD   TYPE DEVICE SIZE/OFF NODE NAME
+kubelet       1 root   1u  IPv4  34567      0t0  TCP *:10250 (LISTEN)
+kubelet       1 root   2u  IPv4  34568      0t0  TCP 127.0.0.1:10248 (LISTEN)
+kubelet       1 root   3u  IPv4  34569      0t0  TCP 10.0.0.1:10250->10.0.0.2:4444 (ESTABLISHED)
+rpcbind       5 rpc    6u  IPv4  12346      0t0  UDP *:111
+ptp4l         9 root   4u  IPv4  12347      0t0  UDP 10.0.0.1:319->10.0.0.2:319
+`
+		combined = `Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+tcp   LISTEN 0      4096         0.0.0.0:10250      0.0.0.0:*    users:(("kubelet",pid=1,fd=1))
+tcp   LISTEN 0      4096       127.0.0.1:10248      0.0.0.0:*    users:(("kubelet",pid=1,fd=2))
+tcp   ESTAB  0      0         10.0.0.1:10250     10.0.0.2:4444    users:(("kubelet",pid=1,fd=3))
+udp   UNCONN 0      0            0.0.0.0:111        0.0.0.0:*    users:(("rpcbind",pid=5,fd=6))
+udp   ESTAB  0      0         10.0.0.1:319       10.0.0.2:319    users:(("ptp4l",pid=9,fd=4))
+`
+		expected = []commatrix.ComDetails{
+			{Direction: "ingress", Protocol: "TCP", Port: "10250", NodeRole: "worker", ServiceName: "kubelet", Required: true},
+			{Direction: "ingress", Protocol: "UDP", Port: "319", NodeRole: "worker", ServiceName: "ptp4l", Required: true},
+		}
+	)
+
+	tests := []struct {
+		desc string
+		res  []commatrix.ComDetails
+	}{
+		{desc: "ss", res: append(ToComDetails(ssTCP, "worker", "TCP"), ToComDetails(ssUDP, "worker", "UDP")...)},
+		{desc: "netstat", res: NetstatToComDetails(netstat, "worker")},
+		{desc: "lsof", res: LsofToComDetails(lsof, "worker")},
+		{desc: "ss-combined", res: CombinedToComDetails(combined, "worker")},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.res, expected) {
+			t.Fatalf("test \"%s\" failed: got %v, expected %v", test.desc, test.res, expected)
+		}
+	}
+}
+
+func TestParseSSCombinedSkipsRawSockets(t *testing.T) {
+	for _, s := range ParseSSCombined(ssCombinedOutput) {
+		if s.Port == "112" {
+			t.Fatalf("got socket %+v, expected the raw socket to be skipped", s)
+		}
+	}
+}